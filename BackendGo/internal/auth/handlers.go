@@ -0,0 +1,380 @@
+package auth
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type loginReq struct { Email, Password string; DeviceName string `json:"device_name"` }
+
+func HandleLogin(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	var req loginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+	dev := DeviceFromRequest(r, req.DeviceName)
+	if wait, err := s.loginRetryAfter(req.Email, dev.IP); err != nil {
+		return err
+	} else if wait > 0 {
+		writeRetryAfter(w, wait); http.Error(w, "too many failed attempts", http.StatusTooManyRequests); return nil
+	}
+
+	var (
+		id   string
+		ph   string
+		role string
+	)
+	err := s.st.DB.QueryRowx(`SELECT id, password_hash, role FROM users WHERE email=$1`, req.Email).Scan(&id, &ph, &role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			checkPassword(req.Password, dummyHash)
+			s.recordLoginFailure(req.Email, dev.IP, "", "unknown_email")
+			http.Error(w, "invalid credentials", http.StatusUnauthorized); return nil
+		}
+		return err
+	}
+
+	ok, rehash := checkPassword(req.Password, ph)
+	if !ok { s.recordLoginFailure(req.Email, dev.IP, id, "bad_password"); http.Error(w, "invalid credentials", http.StatusUnauthorized); return nil }
+	if rehash {
+		// Upgrade legacy/outdated hashes transparently; a failure here must not block login.
+		if nh, err := hashPassword(req.Password); err == nil { _, _ = s.st.DB.Exec(`UPDATE users SET password_hash=$1 WHERE id=$2 AND password_hash=$3`, nh, id, ph) }
+	}
+	resp, err := s.signIn(jwt, subject{UserID: id, Email: req.Email, Role: role}, dev)
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(resp)
+}
+
+type mfaLoginReq struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	DeviceName   string `json:"device_name"`
+}
+
+func HandleLoginMFA(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req mfaLoginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	tp, c, err := s.CompleteMFALogin(jwt, req.MFAToken, req.Code, req.RecoveryCode, DeviceFromRequest(r, req.DeviceName))
+	var te *ThrottledError
+	if errors.As(err, &te) { writeRetryAfter(w, te.RetryAfter); http.Error(w, "too many failed attempts", http.StatusTooManyRequests); return nil }
+	if errors.Is(err, ErrInvalidCode) || errors.Is(err, ErrMFANotEnabled) { http.Error(w, "invalid code", http.StatusUnauthorized); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(tokenResp(tp, c.UserID, c.Email))
+}
+
+func HandleMFAEnroll(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	secret, uri, err := s.EnrollMFA(u.UserID, u.Email)
+	if errors.Is(err, ErrMFAEnabled) { http.Error(w, err.Error(), http.StatusConflict); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(map[string]string{"secret": secret, "otpauth_uri": uri})
+}
+
+type mfaCodeReq struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+	Password     string `json:"password"` // disable only
+}
+
+func HandleMFAActivate(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	var req mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	codes, err := s.ActivateMFA(u.UserID, req.Code)
+	if errors.Is(err, ErrMFAEnabled) { http.Error(w, err.Error(), http.StatusConflict); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(map[string]any{"enabled": true, "recovery_codes": codes})
+}
+
+func HandleMFADisable(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	var req mfaCodeReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	err := s.DisableMFA(u, req.Password, req.Code, req.RecoveryCode)
+	if errors.Is(err, ErrWrongPassword) || errors.Is(err, ErrReauthRequired) { http.Error(w, err.Error(), http.StatusForbidden); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func HandleRegister(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req loginReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	email, err := NormalizeEmail(req.Email)
+	if err != nil { return err }
+	if err := ValidatePassword(req.Password, email); err != nil { return err }
+	ph, err := hashPassword(req.Password)
+	if err != nil { return err }
+
+	var id string
+	err = s.st.DB.QueryRowx(`INSERT INTO users(email, password_hash) VALUES($1,$2) ON CONFLICT (email) DO NOTHING RETURNING id`, email, ph).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) { http.Error(w, "email already registered", http.StatusConflict); return nil }
+	if err != nil { return err }
+	tp, err := s.issue(jwt, subject{UserID: id, Email: email, Role: RoleUser}, DeviceFromRequest(r, req.DeviceName))
+	if err != nil { return err }
+	// The account is usable right away; the link can be re-sent if this mail is lost.
+	if err := s.SendVerification(id); err != nil { log.Printf("verification mail for %s: %v", id, err) }
+
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(tokenResp(tp, id, email))
+}
+
+type refreshReq struct{ RefreshToken string `json:"refresh_token"` }
+
+func HandleRefresh(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req refreshReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	sub, next, err := s.Rotate(req.RefreshToken)
+	if errors.Is(err, ErrInvalidRefresh) || errors.Is(err, ErrRefreshReuse) { http.Error(w, err.Error(), http.StatusUnauthorized); return nil }
+	if err != nil { return err }
+	tp, err := s.pair(jwt, sub, next)
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(tokenResp(tp, sub.UserID, sub.Email))
+}
+
+type resetReq struct{ Email string }
+
+// HandleResetRequest always answers 202 so it cannot be used to probe for accounts.
+func HandleResetRequest(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req resetReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if err := s.RequestPasswordReset(strings.TrimSpace(strings.ToLower(req.Email))); err != nil { return err }
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(map[string]string{"status": "ok"})
+}
+
+type resetConfirmReq struct{ Token, Password string }
+
+func HandleResetConfirm(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req resetConfirmReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if err := s.ConfirmPasswordReset(req.Token, req.Password); err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type verifyReq struct{ Token string }
+
+func HandleVerifyEmail(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req verifyReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if err := s.VerifyEmail(req.Token); err != nil { return err }
+	return json.NewEncoder(w).Encode(map[string]string{"status": "verified"})
+}
+
+func HandleResendVerification(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	err := s.SendVerification(u.UserID)
+	var te *ThrottledError
+	if errors.As(err, &te) { writeRetryAfter(w, te.RetryAfter); http.Error(w, err.Error(), http.StatusTooManyRequests); return nil }
+	if errors.Is(err, ErrAlreadyVerified) { http.Error(w, err.Error(), http.StatusConflict); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(map[string]string{"status": "sent"})
+}
+
+// HandleOIDCLogin redirects the browser to the identity provider and sets
+// the state cookie the callback checks.
+func HandleOIDCLogin(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u, cookie, err := s.StartOIDC(jwt, r.URL.Query().Get("device_name"))
+	if errors.Is(err, ErrOIDCDisabled) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if err != nil { return err }
+	setOIDCCookie(w, r, cookie, int(oidcStateTTL/time.Second))
+	http.Redirect(w, r, u, http.StatusFound)
+	return nil
+}
+
+// HandleOIDCCallback takes the code and state the IdP sent to OIDC_REDIRECT_URL
+// (the web client forwards them, with credentials so the state cookie comes
+// along) and answers like a password login, including the mfa_token
+// challenge for accounts with two-factor authentication. An identity whose
+// email matches an existing account gets 409 and a link_token for
+// /api/auth/oidc/link.
+func HandleOIDCCallback(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	q := r.URL.Query()
+	var cookie string
+	if c, err := r.Cookie(OIDCStateCookie); err == nil { cookie = c.Value }
+	setOIDCCookie(w, r, "", -1) // one callback per sign-in attempt
+	if e := q.Get("error"); e != "" { http.Error(w, "sign-in failed: "+e, http.StatusUnauthorized); return nil }
+	sub, device, err := s.FinishOIDC(jwt, cookie, q.Get("state"), q.Get("code"))
+	var le *LinkRequiredError
+	switch {
+	case errors.Is(err, ErrOIDCDisabled): http.Error(w, err.Error(), http.StatusNotFound); return nil
+	case errors.Is(err, ErrOIDCState), errors.Is(err, ErrOIDCNotLinked): http.Error(w, err.Error(), http.StatusForbidden); return nil
+	case errors.As(err, &le):
+		w.WriteHeader(http.StatusConflict)
+		return json.NewEncoder(w).Encode(map[string]any{"link_required": true, "link_token": le.Token, "error": le.Error()})
+	case err != nil: return err
+	}
+	resp, err := s.signIn(jwt, *sub, DeviceFromRequest(r, device))
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(resp)
+}
+
+type oidcLinkReq struct {
+	LinkToken string `json:"link_token"`
+	Password  string `json:"password"`
+}
+
+// HandleOIDCLink confirms a link_token from the callback with the matched
+// account's password, then answers like a password login.
+func HandleOIDCLink(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	var req oidcLinkReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	ip := DeviceFromRequest(r, "").IP
+	sub, device, err := s.LinkOIDC(jwt, req.LinkToken, req.Password, ip)
+	var te *ThrottledError
+	switch {
+	case errors.As(err, &te): writeRetryAfter(w, te.RetryAfter); http.Error(w, "too many failed attempts", http.StatusTooManyRequests); return nil
+	case errors.Is(err, ErrWrongPassword): http.Error(w, "invalid credentials", http.StatusUnauthorized); return nil
+	case errors.Is(err, ErrOIDCState): http.Error(w, err.Error(), http.StatusForbidden); return nil
+	case err != nil: return err
+	}
+	resp, err := s.signIn(jwt, *sub, DeviceFromRequest(r, device))
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(resp)
+}
+
+func setOIDCCookie(w http.ResponseWriter, r *http.Request, value string, maxAge int) {
+	http.SetCookie(w, &http.Cookie{Name: OIDCStateCookie, Value: value, Path: "/api/auth/oidc", MaxAge: maxAge, HttpOnly: true,
+		Secure: r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https", SameSite: http.SameSiteLaxMode})
+}
+
+// HandleLogout revokes the caller's access token and ends its session, which
+// also invalidates the session's refresh tokens.
+func HandleLogout(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	if err := s.rev.Revoke(u); err != nil { return err }
+	if u.SessionID != "" {
+		if err := s.rev.RevokeSession(u.UserID, u.SessionID); err != nil && !errors.Is(err, ErrSessionNotFound) { return err }
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// HandleLogoutAll revokes every token the caller holds on any device.
+func HandleLogoutAll(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	if r.Method != http.MethodPost { w.WriteHeader(http.StatusMethodNotAllowed); return nil }
+	u := r.Context().Value("user").(*Claims)
+	if err := s.rev.Revoke(u); err != nil { return err }
+	if err := s.rev.RevokeAll(u.UserID); err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func HandleListSessions(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	items, err := s.ListSessions(u.UserID)
+	if err != nil { return err }
+	for i := range items { items[i].Current = items[i].ID == u.SessionID }
+	return json.NewEncoder(w).Encode(items)
+}
+
+// HandleRevokeSession signs out one of the caller's devices (DELETE /api/sessions/{id}).
+func HandleRevokeSession(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	err := s.rev.RevokeSession(u.UserID, id)
+	if errors.Is(err, ErrSessionNotFound) { http.Error(w, "session not found", http.StatusNotFound); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+type setRoleReq struct{ Role string `json:"role"` }
+
+// HandleSetRole serves PUT /api/admin/users/{id}/role; routes must sit behind RequireRole(RoleAdmin).
+func HandleSetRole(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	id := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/api/admin/users/"), "/role")
+	var req setRoleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	err := s.SetRole(u.UserID, id, req.Role)
+	switch {
+	case errors.Is(err, ErrUserNotFound): http.Error(w, err.Error(), http.StatusNotFound); return nil
+	case errors.Is(err, ErrOwnRole): http.Error(w, err.Error(), http.StatusForbidden); return nil
+	case err != nil: return err
+	}
+	return json.NewEncoder(w).Encode(map[string]string{"id": id, "role": req.Role})
+}
+
+type createPATReq struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expires_in_days"` // 0 = 30 days; at most 365
+}
+
+func HandleCreatePAT(p *PATs, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	var req createPATReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	t, plain, err := p.Create(u.UserID, req.Name, req.Scopes, time.Duration(req.ExpiresInDays)*24*time.Hour)
+	if err != nil { return err }
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(map[string]any{"token": plain, "pat": t})
+}
+
+func HandleListPATs(p *PATs, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	items, err := p.List(u.UserID)
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(items)
+}
+
+// HandleRevokePAT handles DELETE /api/tokens/{id}.
+func HandleRevokePAT(p *PATs, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	err := p.Revoke(u.UserID, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if errors.Is(err, ErrPATNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+func HandleMe(s *Service, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*Claims)
+	var (
+		createdAt  time.Time
+		verifiedAt *time.Time
+		role       string
+	)
+	err := s.st.DB.QueryRowx(`SELECT created_at, email_verified_at, role FROM users WHERE id=$1`, u.UserID).Scan(&createdAt, &verifiedAt, &role)
+	if err != nil { return err }
+	resp := map[string]any{"id": u.UserID, "email": u.Email, "role": role, "created_at": createdAt, "email_verified": verifiedAt != nil}
+	w.Header().Set("Content-Type", "application/json")
+	return json.NewEncoder(w).Encode(resp)
+}
+
+// HandleJWKS publishes the public keys other services use to verify our tokens.
+func HandleJWKS(jwt *JWT, w http.ResponseWriter, r *http.Request) error {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	return json.NewEncoder(w).Encode(jwt.JWKS())
+}
+
+func writeRetryAfter(w http.ResponseWriter, d time.Duration) {
+	secs := int64(d.Round(time.Second) / time.Second)
+	if secs < 1 { secs = 1 }
+	w.Header().Set("Retry-After", strconv.FormatInt(secs, 10))
+}
+
+func tokenResp(tp *TokenPair, userID, email string) map[string]any {
+	return map[string]any{"token": tp.AccessToken, "refresh_token": tp.RefreshToken, "expires_in": tp.ExpiresIn, "user": map[string]any{"id": userID, "email": email}}
+}
@@ -1,78 +1,202 @@
 package auth
 
 import (
-	"database/sql"
-	"encoding/json"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
 	"errors"
-	"net/http"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
-	"github.com/jmoiron/sqlx"
 )
 
-type JWT struct{ secret []byte }
-func NewJWT(secret string) *JWT { return &JWT{secret: []byte(secret)} }
+// JWT signs and verifies access tokens. With key files loaded it signs with
+// the active asymmetric key and stamps its kid; every loaded key stays valid
+// for verification so tokens survive a rotation. The HMAC secret is only
+// used when no signing key is configured, and to accept tokens without kid.
+// Callers pass a secret only when the deployment opted in to HS256, which
+// ends at HS256Sunset.
+type JWT struct {
+	secret []byte
+	signer *jwtKey
+	keys   map[string]*jwtKey
+}
 
-type Claims struct {
-	UserID string `json:"user_id"`
-	Email  string `json:"email"`
-	jwt.RegisteredClaims
+type jwtKey struct {
+	kid    string
+	method jwt.SigningMethod
+	priv   crypto.Signer // nil for verification-only keys
+	pub    crypto.PublicKey
 }
 
-func (j *JWT) Sign(userID, email string, ttl time.Duration) (string, error) {
-	claims := Claims{UserID: userID, Email: email, RegisteredClaims: jwt.RegisteredClaims{ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl))}}
-	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return t.SignedString(j.secret)
+// HS256Sunset is the last day the HS256 fallback may be enabled; after it
+// the server refuses to start with JWT_ALLOW_HS256 and the fallback is due
+// for removal.
+var HS256Sunset = time.Date(2027, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+func NewJWT(secret string) *JWT { return &JWT{secret: []byte(secret), keys: map[string]*jwtKey{}} }
+
+// LoadJWT reads every *.pem in dir; the file name without extension is the
+// kid. Private keys (PKCS#8, or PKCS#1 for RSA) can sign, public keys only
+// verify, which is how retired keys are kept around. activeKID picks the
+// signing key, defaulting to the last private key by name. Add a key file
+// and restart to rotate; drop the old file once its tokens have expired.
+func LoadJWT(dir, activeKID, secret string) (*JWT, error) {
+	j := NewJWT(secret)
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil { return nil, err }
+	sort.Strings(files)
+	for _, f := range files {
+		k, err := readJWTKey(f)
+		if err != nil { return nil, fmt.Errorf("jwt key %s: %w", filepath.Base(f), err) }
+		j.keys[k.kid] = k
+		if k.priv != nil && (activeKID == "" || activeKID == k.kid) { j.signer = k }
+	}
+	if activeKID != "" && j.signer == nil { return nil, fmt.Errorf("jwt signing key %q not found in %s", activeKID, dir) }
+	if j.signer == nil && len(j.secret) == 0 { return nil, errors.New("no jwt signing key or secret configured") }
+	return j, nil
 }
 
-func (j *JWT) Parse(token string) (*Claims, error) {
-	parsed, err := jwt.ParseWithClaims(token, &Claims{}, func(t *jwt.Token) (interface{}, error) { return j.secret, nil })
+func readJWTKey(path string) (*jwtKey, error) {
+	raw, err := os.ReadFile(path)
 	if err != nil { return nil, err }
-	if c, ok := parsed.Claims.(*Claims); ok && parsed.Valid { return c, nil }
-	return nil, errors.New("invalid token")
+	block, _ := pem.Decode(raw)
+	if block == nil { return nil, errors.New("no PEM block") }
+	k := &jwtKey{kid: strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))}
+
+	var parsed any
+	switch block.Type {
+	case "PRIVATE KEY": parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY": parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY": parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default: return nil, fmt.Errorf("unsupported PEM type %q", block.Type)
+	}
+	if err != nil { return nil, err }
+
+	switch key := parsed.(type) {
+	case ed25519.PrivateKey: k.method, k.priv, k.pub = jwt.SigningMethodEdDSA, key, key.Public()
+	case ed25519.PublicKey: k.method, k.pub = jwt.SigningMethodEdDSA, key
+	case *rsa.PrivateKey: k.method, k.priv, k.pub = jwt.SigningMethodRS256, key, key.Public()
+	case *rsa.PublicKey: k.method, k.pub = jwt.SigningMethodRS256, key
+	default: return nil, fmt.Errorf("unsupported key type %T (want Ed25519 or RSA)", parsed)
+	}
+	if rk, ok := k.pub.(*rsa.PublicKey); ok && rk.N.BitLen() < 2048 { return nil, errors.New("RSA keys must be at least 2048 bits") }
+	return k, nil
 }
 
-// Handlers
+type Claims struct {
+	UserID    string `json:"user_id"`
+	Email     string `json:"email"`
+	SessionID string `json:"sid,omitempty"`
+	Role      string `json:"role,omitempty"`
+	// Purpose marks restricted tokens (e.g. PurposeMFA); access tokens leave it empty.
+	Purpose string `json:"purpose,omitempty"`
+	// Scopes is nil for interactive logins (full access) and set for
+	// personal access tokens.
+	Scopes []string `json:"scp,omitempty"`
+	jwt.RegisteredClaims
+}
+
+// HasScope reports whether the token may be used for scope.
+func (c *Claims) HasScope(scope string) bool {
+	if c.Scopes == nil { return true }
+	for _, s := range c.Scopes { if s == scope { return true } }
+	return false
+}
 
-type loginReq struct { Email, Password string }
+// PurposeMFA tokens prove the password step of a login and can only be
+// exchanged for real tokens at /api/auth/login/mfa.
+const PurposeMFA = "mfa"
 
-func HandleLogin(db *sqlx.DB, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
-	var req loginReq
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
-	req.Email = strings.TrimSpace(strings.ToLower(req.Email))
+// Sign issues a token for the given claims; jti, iat and exp are filled in here.
+func (j *JWT) Sign(claims Claims, ttl time.Duration) (string, error) {
+	rc, err := registered(ttl)
+	if err != nil { return "", err }
+	claims.RegisteredClaims = rc
+	return j.signRaw(claims)
+}
 
-	var (
-		id string
-		ph string
-	)
-	err := db.QueryRowx(`SELECT id, password_hash FROM users WHERE email=$1`, req.Email).Scan(&id, &ph)
-	if err != nil { if errors.Is(err, sql.ErrNoRows) { http.Error(w, "invalid credentials", http.StatusUnauthorized); return nil } ; return err }
+// signRaw and parseRaw handle claim types other than Claims (e.g. the
+// single sign-on state) with the same keys. Such types must carry a
+// "purpose" so they never pass for an access token.
+func (j *JWT) signRaw(claims jwt.Claims) (string, error) {
+	if j.signer != nil {
+		t := jwt.NewWithClaims(j.signer.method, claims)
+		t.Header["kid"] = j.signer.kid
+		return t.SignedString(j.signer.priv)
+	}
+	t := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return t.SignedString(j.secret)
+}
 
-	if !checkPassword(req.Password, ph) { http.Error(w, "invalid credentials", http.StatusUnauthorized); return nil }
-	tok, err := jwt.Sign(id, req.Email, 24*time.Hour)
+func (j *JWT) parseRaw(token string, claims jwt.Claims) error {
+	parsed, err := jwt.ParseWithClaims(token, claims, j.keyFor)
 	if err != nil { return err }
+	if !parsed.Valid { return errors.New("invalid token") }
+	return nil
+}
 
-	resp := map[string]any{"token": tok, "user": map[string]any{"id": id, "email": req.Email}}
-	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(resp)
+// registered fills in jti, iat and exp for a token living ttl.
+func registered(ttl time.Duration) (jwt.RegisteredClaims, error) {
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil { return jwt.RegisteredClaims{}, err }
+	now := time.Now()
+	return jwt.RegisteredClaims{ID: hex.EncodeToString(jti), IssuedAt: jwt.NewNumericDate(now), ExpiresAt: jwt.NewNumericDate(now.Add(ttl))}, nil
 }
 
-func HandleMe(db *sqlx.DB, jwt *JWT, w http.ResponseWriter, r *http.Request) error {
-	u := r.Context().Value("user").(*Claims)
-	var createdAt time.Time
-	err := db.QueryRowx(`SELECT created_at FROM users WHERE id=$1`, u.UserID).Scan(&createdAt)
-	if err != nil { return err }
-	resp := map[string]any{"id": u.UserID, "email": u.Email, "created_at": createdAt}
-	w.Header().Set("Content-Type", "application/json")
-	return json.NewEncoder(w).Encode(resp)
+// Parse verifies an access token.
+func (j *JWT) Parse(token string) (*Claims, error) { return j.ParsePurpose(token, "") }
+
+// ParsePurpose verifies a token issued for the given purpose.
+func (j *JWT) ParsePurpose(token, purpose string) (*Claims, error) {
+	parsed, err := jwt.ParseWithClaims(token, &Claims{}, j.keyFor)
+	if err != nil { return nil, err }
+	if c, ok := parsed.Claims.(*Claims); ok && parsed.Valid && c.Purpose == purpose { return c, nil }
+	return nil, errors.New("invalid token")
 }
 
-// Password helpers (replace with argon2/bcrypt in prod)
-func checkPassword(plain, storedHash string) bool {
-	// For demo: storedHash is bcrypt. In production ensure bcrypt.CompareHashAndPassword.
-	return bcryptCompare(storedHash, plain) == nil
+// keyFor pins the verification key and algorithm by kid so a token can never
+// pick its own algorithm (e.g. HS256 keyed with a public key).
+func (j *JWT) keyFor(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	if kid == "" {
+		if len(j.secret) == 0 || t.Method != jwt.SigningMethodHS256 { return nil, errors.New("unexpected signing method") }
+		return j.secret, nil
+	}
+	k := j.keys[kid]
+	if k == nil { return nil, fmt.Errorf("unknown kid %q", kid) }
+	if t.Method.Alg() != k.method.Alg() { return nil, errors.New("unexpected signing method") }
+	return k.pub, nil
 }
 
-func bcryptCompare(hash, plain string) error { return nil } // replace in real build
+// JWKS returns the public verification keys as a JSON Web Key Set.
+func (j *JWT) JWKS() map[string]any {
+	kids := make([]string, 0, len(j.keys))
+	for kid := range j.keys { kids = append(kids, kid) }
+	sort.Strings(kids)
+	b64 := base64.RawURLEncoding
+	keys := make([]map[string]string, 0, len(kids))
+	for _, kid := range kids {
+		k := j.keys[kid]
+		jwk := map[string]string{"kid": kid, "use": "sig", "alg": k.method.Alg()}
+		switch pub := k.pub.(type) {
+		case ed25519.PublicKey:
+			jwk["kty"], jwk["crv"], jwk["x"] = "OKP", "Ed25519", b64.EncodeToString(pub)
+		case *rsa.PublicKey:
+			jwk["kty"], jwk["n"], jwk["e"] = "RSA", b64.EncodeToString(pub.N.Bytes()), b64.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		}
+		keys = append(keys, jwk)
+	}
+	return map[string]any{"keys": keys}
+}
@@ -0,0 +1,65 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeKey(t *testing.T, dir, kid, typ string, der []byte) {
+	t.Helper()
+	b := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, kid+".pem"), b, 0o600); err != nil { t.Fatal(err) }
+}
+
+func TestJWTKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+	writeKey(t, dir, "2026-01", "PRIVATE KEY", der)
+
+	old, err := LoadJWT(dir, "", "")
+	if err != nil { t.Fatal(err) }
+	oldTok, err := old.Sign(Claims{UserID: "u1"}, time.Minute)
+	if err != nil { t.Fatal(err) }
+
+	// Rotate: the new RSA key signs, the Ed25519 one is kept for verification only.
+	rsaPriv, _ := rsa.GenerateKey(rand.Reader, 2048)
+	writeKey(t, dir, "2026-02", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaPriv))
+	pubDER, _ := x509.MarshalPKIXPublicKey(edPriv.Public())
+	writeKey(t, dir, "2026-01", "PUBLIC KEY", pubDER)
+
+	cur, err := LoadJWT(dir, "", "")
+	if err != nil { t.Fatal(err) }
+	if cur.signer.kid != "2026-02" { t.Fatalf("signing kid = %s", cur.signer.kid) }
+	if c, err := cur.Parse(oldTok); err != nil || c.UserID != "u1" { t.Fatalf("old token: %v", err) }
+	newTok, _ := cur.Sign(Claims{UserID: "u2"}, time.Minute)
+	if c, err := cur.Parse(newTok); err != nil || c.UserID != "u2" { t.Fatalf("new token: %v", err) }
+
+	keys := cur.JWKS()["keys"].([]map[string]string)
+	if len(keys) != 2 || keys[0]["kty"] != "OKP" || keys[1]["kty"] != "RSA" { t.Fatalf("jwks = %v", keys) }
+}
+
+func TestJWTRejectsUnpinnedTokens(t *testing.T) {
+	dir := t.TempDir()
+	_, edPriv, _ := ed25519.GenerateKey(rand.Reader)
+	der, _ := x509.MarshalPKCS8PrivateKey(edPriv)
+	writeKey(t, dir, "k1", "PRIVATE KEY", der)
+	j, err := LoadJWT(dir, "k1", "")
+	if err != nil { t.Fatal(err) }
+
+	hs, _ := NewJWT("secret").Sign(Claims{UserID: "u"}, time.Minute)
+	if _, err := j.Parse(hs); err == nil { t.Fatal("HS256 token accepted without a configured secret") }
+
+	other, _ := LoadJWT(dir, "k1", "")
+	_, otherPriv, _ := ed25519.GenerateKey(rand.Reader)
+	other.signer = &jwtKey{kid: "k2", method: other.signer.method, priv: otherPriv, pub: otherPriv.Public()}
+	tok, _ := other.Sign(Claims{UserID: "u"}, time.Minute)
+	if _, err := j.Parse(tok); err == nil { t.Fatal("unknown kid accepted") }
+}
@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"time"
+)
+
+// lockoutPolicy turns a run of recent failures into a wait. After Free
+// failures every attempt must wait an exponentially growing delay (1s, 2s,
+// 4s, ... capped at MaxDelay); at Lock failures the key is locked for
+// LockFor. Failures older than Window, or cleared by a successful login,
+// do not count.
+type lockoutPolicy struct {
+	Free     int
+	Lock     int
+	MaxDelay time.Duration
+	LockFor  time.Duration
+	Window   time.Duration
+}
+
+var (
+	accountLockout = lockoutPolicy{Free: 3, Lock: 10, MaxDelay: 5 * time.Minute, LockFor: 15 * time.Minute, Window: 15 * time.Minute}
+	// Shared NAT and offices put many users behind one IP, so be more lenient.
+	ipLockout = lockoutPolicy{Free: 20, Lock: 100, MaxDelay: 5 * time.Minute, LockFor: 15 * time.Minute, Window: 15 * time.Minute}
+)
+
+// retryAfter returns how long to wait before the next attempt is allowed.
+func (p lockoutPolicy) retryAfter(failures int, last, now time.Time) time.Duration {
+	if failures < p.Free || last.IsZero() { return 0 }
+	wait := p.LockFor
+	if failures < p.Lock {
+		wait = p.MaxDelay
+		if shift := failures - p.Free; shift < 20 { wait = min(time.Second<<shift, p.MaxDelay) }
+	}
+	if d := last.Add(wait).Sub(now); d > 0 { return d }
+	return 0
+}
+
+// loginRetryAfter consults recent failures for the account and the client IP.
+func (s *Service) loginRetryAfter(email, ip string) (time.Duration, error) {
+	var (
+		acctN, ipN       int
+		acctLast, ipLast *time.Time
+	)
+	err := s.st.DB.QueryRowx(`SELECT
+			count(*) FILTER (WHERE email=$1), max(created_at) FILTER (WHERE email=$1),
+			count(*) FILTER (WHERE ip=$2), max(created_at) FILTER (WHERE ip=$2)
+		FROM auth_failures WHERE cleared_at IS NULL AND created_at > $3 AND (email=$1 OR ip=$2)`,
+		email, ip, time.Now().UTC().Add(-accountLockout.Window)).Scan(&acctN, &acctLast, &ipN, &ipLast)
+	if err != nil { return 0, err }
+	now := time.Now()
+	var wait time.Duration
+	if acctLast != nil { wait = accountLockout.retryAfter(acctN, *acctLast, now) }
+	if ipLast != nil { wait = max(wait, ipLockout.retryAfter(ipN, *ipLast, now)) }
+	return wait, nil
+}
+
+// recordLoginFailure writes the audit row that also feeds the lockout.
+func (s *Service) recordLoginFailure(email, ip, userID, reason string) {
+	var uid any
+	if userID != "" { uid = userID }
+	_, _ = s.st.DB.Exec(`INSERT INTO auth_failures(email, ip, user_id, reason) VALUES($1,$2,$3,$4)`, email, ip, uid, reason)
+}
+
+// recordMFAFailure records a wrong code for the mfa token c; it counts
+// towards the lockout and the token's own attempt limit.
+func (s *Service) recordMFAFailure(c *Claims, ip string) {
+	_, _ = s.st.DB.Exec(`INSERT INTO auth_failures(email, ip, user_id, reason, token_id) VALUES($1,$2,$3,'bad_mfa_code',$4)`, c.Email, ip, c.UserID, c.ID)
+}
+
+// clearLoginFailures resets the account's counter after a successful login.
+// The IP counter only decays, so one valid account cannot unlock an IP.
+func (s *Service) clearLoginFailures(email string) {
+	_, _ = s.st.DB.Exec(`UPDATE auth_failures SET cleared_at=now() WHERE email=$1 AND cleared_at IS NULL`, email)
+}
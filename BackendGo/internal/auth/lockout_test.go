@@ -0,0 +1,20 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockoutBackoff(t *testing.T) {
+	p := lockoutPolicy{Free: 3, Lock: 6, MaxDelay: 3 * time.Second, LockFor: time.Minute, Window: time.Hour}
+	now := time.Now()
+	cases := []struct {
+		failures int
+		want     time.Duration
+	}{{0, 0}, {2, 0}, {3, time.Second}, {4, 2 * time.Second}, {5, 3 * time.Second}, {6, time.Minute}, {50, time.Minute}}
+	for _, c := range cases {
+		if got := p.retryAfter(c.failures, now, now); got != c.want { t.Errorf("%d failures: got %s want %s", c.failures, got, c.want) }
+	}
+	if got := p.retryAfter(4, now.Add(-5*time.Second), now); got != 0 { t.Errorf("elapsed backoff should allow, got %s", got) }
+	if got := p.retryAfter(6, now.Add(-20*time.Second), now); got != 40*time.Second { t.Errorf("lock remaining = %s", got) }
+}
@@ -0,0 +1,145 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	mfaTokenTTL       = 5 * time.Minute
+	mfaMaxAttempts    = 5 // wrong codes allowed per mfa token
+	recoveryCodeCount = 10
+)
+
+var (
+	ErrMFAEnabled     = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnabled  = errors.New("two-factor authentication is not enabled")
+	ErrMFANotEnrolled = errors.New("start enrollment first")
+	ErrInvalidCode    = errors.New("invalid code")
+)
+
+// mfaTokenExhausted reports whether the mfa token jti has used up its wrong
+// codes. They are counted from auth_failures, so restarts do not reset them.
+func (s *Service) mfaTokenExhausted(jti string) (bool, error) {
+	var n int
+	err := s.st.DB.QueryRowx(`SELECT count(*) FROM auth_failures WHERE token_id=$1`, jti).Scan(&n)
+	return n >= mfaMaxAttempts, err
+}
+
+func (s *Service) MFAEnabled(userID string) (bool, error) {
+	var on bool
+	err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM user_mfa WHERE user_id=$1 AND enabled_at IS NOT NULL)`, userID).Scan(&on)
+	return on, err
+}
+
+// EnrollMFA creates (or replaces) a pending TOTP secret for the user.
+func (s *Service) EnrollMFA(userID, email string) (secret, uri string, err error) {
+	if on, err := s.MFAEnabled(userID); err != nil || on {
+		if err == nil { err = ErrMFAEnabled }
+		return "", "", err
+	}
+	if secret, err = newTOTPSecret(); err != nil { return "", "", err }
+	_, err = s.st.DB.Exec(`INSERT INTO user_mfa(user_id, secret) VALUES($1,$2)
+		ON CONFLICT (user_id) DO UPDATE SET secret=EXCLUDED.secret, enabled_at=NULL, last_used_step=0, created_at=now()`, userID, secret)
+	if err != nil { return "", "", err }
+	return secret, otpauthURI(s.cfg.MFAIssuer, email, secret), nil
+}
+
+// ActivateMFA confirms enrollment with a first code and returns fresh recovery codes.
+func (s *Service) ActivateMFA(userID, code string) ([]string, error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	var (
+		secret  string
+		enabled *time.Time
+	)
+	err = tx.QueryRowx(`SELECT secret, enabled_at FROM user_mfa WHERE user_id=$1 FOR UPDATE`, userID).Scan(&secret, &enabled)
+	if errors.Is(err, sql.ErrNoRows) { return nil, ErrMFANotEnrolled }
+	if err != nil { return nil, err }
+	if enabled != nil { return nil, ErrMFAEnabled }
+	step, ok := verifyTOTP(secret, code, time.Now())
+	if !ok { return nil, ErrInvalidCode }
+	if _, err := tx.Exec(`UPDATE user_mfa SET enabled_at=now(), last_used_step=$2 WHERE user_id=$1`, userID, step); err != nil { return nil, err }
+	codes, err := newRecoveryCodes(recoveryCodeCount)
+	if err != nil { return nil, err }
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id=$1`, userID); err != nil { return nil, err }
+	for _, c := range codes {
+		if _, err := tx.Exec(`INSERT INTO mfa_recovery_codes(user_id, code_hash) VALUES($1,$2)`, userID, HashToken(c)); err != nil { return nil, err }
+	}
+	return codes, tx.Commit()
+}
+
+// DisableMFA turns 2FA off for c's user. It needs the password (or, without
+// one, a recent sign-in; see Reauthenticate) as well as a current code or
+// recovery code, so neither a stolen session nor a stolen phone is enough.
+func (s *Service) DisableMFA(c *Claims, password, code, recovery string) error {
+	if err := s.Reauthenticate(c, password, ""); err != nil { return err }
+	if err := s.verifySecondFactor(c.UserID, code, recovery, nil); err != nil { return err }
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	if _, err := tx.Exec(`DELETE FROM user_mfa WHERE user_id=$1`, c.UserID); err != nil { return err }
+	if _, err := tx.Exec(`DELETE FROM mfa_recovery_codes WHERE user_id=$1`, c.UserID); err != nil { return err }
+	return tx.Commit()
+}
+
+// verifySecondFactor accepts either a TOTP code (each time step only once) or
+// an unused recovery code, which is consumed. A non-nil burn is an mfa token
+// spent in the same transaction; if it was already spent nothing is consumed.
+func (s *Service) verifySecondFactor(userID, code, recovery string, burn *Claims) error {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	var (
+		secret   string
+		lastStep int64
+	)
+	err = tx.QueryRowx(`SELECT secret, last_used_step FROM user_mfa WHERE user_id=$1 AND enabled_at IS NOT NULL FOR UPDATE`, userID).Scan(&secret, &lastStep)
+	if errors.Is(err, sql.ErrNoRows) { return ErrMFANotEnabled }
+	if err != nil { return err }
+
+	if recovery != "" {
+		res, err := tx.Exec(`UPDATE mfa_recovery_codes SET used_at=now() WHERE user_id=$1 AND code_hash=$2 AND used_at IS NULL`, userID, HashToken(normalizeRecoveryCode(recovery)))
+		if err != nil { return err }
+		if n, _ := res.RowsAffected(); n == 0 { return ErrInvalidCode }
+	} else {
+		step, ok := verifyTOTP(secret, code, time.Now())
+		if !ok || step <= lastStep { return ErrInvalidCode }
+		if _, err := tx.Exec(`UPDATE user_mfa SET last_used_step=$2 WHERE user_id=$1`, userID, step); err != nil { return err }
+	}
+	if burn != nil {
+		res, err := tx.Exec(`INSERT INTO revoked_tokens(jti, user_id, expires_at) VALUES($1,$2,$3) ON CONFLICT (jti) DO NOTHING`, burn.ID, burn.UserID, burn.ExpiresAt.Time)
+		if err != nil { return err }
+		if n, _ := res.RowsAffected(); n == 0 { return ErrInvalidCode }
+	}
+	return tx.Commit()
+}
+
+// CompleteMFALogin exchanges an mfa token plus second factor for a full session.
+func (s *Service) CompleteMFALogin(jwt *JWT, mfaToken, code, recovery string, dev Device) (*TokenPair, *Claims, error) {
+	c, err := jwt.ParsePurpose(mfaToken, PurposeMFA)
+	if err != nil { return nil, nil, ErrInvalidCode }
+	if done, err := s.mfaTokenExhausted(c.ID); err != nil || done {
+		if err == nil { err = ErrInvalidCode }
+		return nil, nil, err
+	}
+	// Wrong codes count towards the account lockout too, so fetching fresh
+	// mfa tokens with a known password does not give unlimited guesses.
+	if wait, err := s.loginRetryAfter(c.Email, dev.IP); err != nil || wait > 0 {
+		if err == nil { err = &ThrottledError{RetryAfter: wait} }
+		return nil, nil, err
+	}
+	// The mfa token is burned together with the code, so it is exchanged at
+	// most once even across concurrent requests and instances.
+	if err := s.verifySecondFactor(c.UserID, code, recovery, c); err != nil {
+		if errors.Is(err, ErrInvalidCode) {
+			s.recordMFAFailure(c, dev.IP)
+		}
+		return nil, nil, err
+	}
+	s.clearLoginFailures(c.Email)
+	tp, err := s.issue(jwt, subject{UserID: c.UserID, Email: c.Email, Role: c.Role}, dev)
+	return tp, c, err
+}
@@ -0,0 +1,187 @@
+package auth
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"time"
+
+	gojwt "github.com/golang-jwt/jwt/v5"
+	"github.com/jmoiron/sqlx"
+	"go-chat-backend/internal/oidc"
+)
+
+const (
+	oidcStateTTL = 10 * time.Minute
+	oidcLinkTTL  = 10 * time.Minute
+
+	purposeOIDCState = "oidc_state"
+	purposeOIDCLink  = "oidc_link"
+
+	// OIDCStateCookie holds the signed sign-in state between the redirect to
+	// the IdP and the callback, binding the callback to the browser that
+	// started it.
+	OIDCStateCookie = "oidc_state"
+)
+
+var (
+	ErrOIDCDisabled  = errors.New("single sign-on is not configured")
+	ErrOIDCState     = errors.New("invalid or expired sign-in state")
+	ErrOIDCNotLinked = errors.New("no account is linked to this identity")
+)
+
+// LinkRequiredError means the IdP identity matches an existing account by
+// email. Token goes to /api/auth/oidc/link together with that account's
+// password; we never link on the email alone.
+type LinkRequiredError struct{ Token string }
+
+func (e *LinkRequiredError) Error() string { return "confirm with your password to link this identity to your account" }
+
+// oidcState is what we remember between redirecting to the IdP and the
+// callback. It is signed and kept in an HttpOnly cookie, so any instance can
+// finish the sign-in and a callback from another browser is refused.
+type oidcState struct {
+	Purpose  string `json:"purpose"`
+	State    string `json:"state"`
+	Verifier string `json:"verifier"`
+	Nonce    string `json:"nonce"`
+	Device   string `json:"device,omitempty"`
+	gojwt.RegisteredClaims
+}
+
+// oidcLink is an IdP identity waiting for a password to confirm the link.
+type oidcLink struct {
+	Purpose string `json:"purpose"`
+	Issuer  string `json:"iss_id"`
+	Subject string `json:"sub_id"`
+	Email   string `json:"email"`
+	Device  string `json:"device,omitempty"`
+	gojwt.RegisteredClaims
+}
+
+// StartOIDC returns the IdP authorization URL for a new sign-in attempt and
+// the value for OIDCStateCookie.
+func (s *Service) StartOIDC(jwt *JWT, deviceName string) (authURL, cookie string, err error) {
+	if s.cfg.OIDC == nil { return "", "", ErrOIDCDisabled }
+	state, _, err := NewOpaqueToken()
+	if err != nil { return "", "", err }
+	nonce, _, err := NewOpaqueToken()
+	if err != nil { return "", "", err }
+	verifier, challenge, err := oidc.NewPKCE()
+	if err != nil { return "", "", err }
+	rc, err := registered(oidcStateTTL)
+	if err != nil { return "", "", err }
+	cookie, err = jwt.signRaw(&oidcState{Purpose: purposeOIDCState, State: state, Verifier: verifier, Nonce: nonce, Device: deviceName, RegisteredClaims: rc})
+	if err != nil { return "", "", err }
+	return s.cfg.OIDC.AuthCodeURL(state, nonce, challenge), cookie, nil
+}
+
+// FinishOIDC redeems the callback and resolves the local user: an existing
+// link, else (if allowed) a freshly provisioned account. An existing account
+// with the same IdP-verified email gives a *LinkRequiredError. It also
+// returns the device name given at the start; the caller signs the user in
+// with signIn.
+func (s *Service) FinishOIDC(jwt *JWT, cookie, state, code string) (*subject, string, error) {
+	if s.cfg.OIDC == nil { return nil, "", ErrOIDCDisabled }
+	var p oidcState
+	if err := jwt.parseRaw(cookie, &p); err != nil || p.Purpose != purposeOIDCState { return nil, "", ErrOIDCState }
+	if state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(p.State)) != 1 { return nil, "", ErrOIDCState }
+	id, err := s.cfg.OIDC.Exchange(code, p.Verifier, p.Nonce)
+	if err != nil { return nil, "", err }
+	sub, err := s.resolveIdentity(jwt, id, p.Device)
+	if err != nil { return nil, "", err }
+	return sub, p.Device, nil
+}
+
+// LinkOIDC links the identity in a link token to the account it matched
+// once the account's password is confirmed. Wrong passwords count towards
+// the login lockout. Accounts without a password (single sign-on only) set
+// one by reset first.
+func (s *Service) LinkOIDC(jwt *JWT, linkToken, password, ip string) (*subject, string, error) {
+	var l oidcLink
+	if err := jwt.parseRaw(linkToken, &l); err != nil || l.Purpose != purposeOIDCLink { return nil, "", ErrOIDCState }
+	if wait, err := s.loginRetryAfter(l.Email, ip); err != nil || wait > 0 {
+		if err == nil { err = &ThrottledError{RetryAfter: wait} }
+		return nil, "", err
+	}
+	sub := &subject{}
+	var ph string
+	err := s.st.DB.QueryRowx(`SELECT id, email, role, password_hash FROM users WHERE email=$1`, l.Email).Scan(&sub.UserID, &sub.Email, &sub.Role, &ph)
+	if errors.Is(err, sql.ErrNoRows) { return nil, "", ErrOIDCState }
+	if err != nil { return nil, "", err }
+	if ok, _ := checkPassword(password, ph); ph == "" || !ok {
+		s.recordLoginFailure(l.Email, ip, sub.UserID, "bad_password")
+		return nil, "", ErrWrongPassword
+	}
+
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, "", err }
+	defer tx.Rollback()
+	if _, err := attachIdentity(tx, sub.UserID, l.Issuer, l.Subject, l.Email); err != nil { return nil, "", err }
+	var owner string
+	if err := tx.QueryRowx(`SELECT user_id FROM user_identities WHERE issuer=$1 AND subject=$2`, l.Issuer, l.Subject).Scan(&owner); err != nil { return nil, "", err }
+	// Linked to another account since the token was issued.
+	if owner != sub.UserID { return nil, "", ErrOIDCState }
+	if _, err := tx.Exec(`UPDATE users SET email_verified_at=COALESCE(email_verified_at, now()) WHERE id=$1`, sub.UserID); err != nil { return nil, "", err }
+	return sub, l.Device, tx.Commit()
+}
+
+// attachIdentity records the link and reports whether it did; if the
+// identity is already linked (a concurrent callback won) that row is kept.
+func attachIdentity(tx *sqlx.Tx, userID, issuer, subject, email string) (bool, error) {
+	res, err := tx.Exec(`INSERT INTO user_identities(user_id, issuer, subject, email, last_login_at) VALUES($1,$2,$3,$4,now())
+		ON CONFLICT (issuer, subject) DO NOTHING`, userID, issuer, subject, email)
+	if err != nil { return false, err }
+	n, _ := res.RowsAffected()
+	return n == 1, nil
+}
+
+// linked returns the user already linked to id and stamps the login.
+func (s *Service) linked(id *oidc.IDToken) (*subject, error) {
+	sub := &subject{}
+	err := s.st.DB.QueryRowx(`UPDATE user_identities i SET last_login_at=now(), email=$3 FROM users u
+		WHERE u.id=i.user_id AND i.issuer=$1 AND i.subject=$2 RETURNING u.id, u.email, u.role`,
+		id.Issuer, id.Subject, id.Email).Scan(&sub.UserID, &sub.Email, &sub.Role)
+	return sub, err
+}
+
+func (s *Service) resolveIdentity(jwt *JWT, id *oidc.IDToken, device string) (*subject, error) {
+	sub, err := s.linked(id)
+	if !errors.Is(err, sql.ErrNoRows) { return sub, err }
+
+	// Only trust the email for matching when the IdP vouches for it.
+	if !id.EmailVerified || id.Email == "" { return nil, ErrOIDCNotLinked }
+	email, err := NormalizeEmail(id.Email)
+	if err != nil { return nil, ErrOIDCNotLinked }
+	var exists bool
+	if err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM users WHERE email=$1)`, email).Scan(&exists); err != nil { return nil, err }
+	if !exists {
+		if !s.cfg.OIDCAutoProvision { return nil, ErrOIDCNotLinked }
+		sub, err := s.provision(id, email)
+		if !errors.Is(err, sql.ErrNoRows) { return sub, err }
+		// Someone registered the email or linked the identity meanwhile.
+		if sub, err := s.linked(id); !errors.Is(err, sql.ErrNoRows) { return sub, err }
+	}
+	rc, err := registered(oidcLinkTTL)
+	if err != nil { return nil, err }
+	tok, err := jwt.signRaw(&oidcLink{Purpose: purposeOIDCLink, Issuer: id.Issuer, Subject: id.Subject, Email: email, Device: device, RegisteredClaims: rc})
+	if err != nil { return nil, err }
+	return nil, &LinkRequiredError{Token: tok}
+}
+
+// provision creates an account for an unknown IdP user. Its password hash is
+// empty: it can only sign in via SSO until a password is set by reset.
+// sql.ErrNoRows means the email or identity was taken concurrently.
+func (s *Service) provision(id *oidc.IDToken, email string) (*subject, error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	sub := &subject{}
+	err = tx.QueryRowx(`INSERT INTO users(email, password_hash, email_verified_at) VALUES($1,'',now())
+		ON CONFLICT (email) DO NOTHING RETURNING id, email, role`, email).Scan(&sub.UserID, &sub.Email, &sub.Role)
+	if err != nil { return nil, err }
+	ok, err := attachIdentity(tx, sub.UserID, id.Issuer, id.Subject, email)
+	if err != nil { return nil, err }
+	if !ok { return nil, sql.ErrNoRows }
+	return sub, tx.Commit()
+}
@@ -0,0 +1,105 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/mail"
+	"strings"
+	"unicode"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// argon2id parameters for new hashes. Changing them makes older hashes
+// report needsRehash, so they are upgraded on the next successful login.
+const (
+	argonTime    uint32 = 1
+	argonMemory  uint32 = 64 * 1024
+	argonThreads uint8  = 4
+	argonKeyLen  uint32 = 32
+	argonSaltLen        = 16
+)
+
+const (
+	minPasswordLen = 10
+	maxPasswordLen = 256
+)
+
+var (
+	ErrInvalidEmail = errors.New("invalid email")
+	ErrWeakPassword = errors.New("password must be 10-256 characters and mix letters with digits or symbols")
+)
+
+// dummyHash is compared against when the email is unknown so that login
+// timing does not reveal which accounts exist.
+var dummyHash, _ = hashPassword("dummy-password-for-timing")
+
+// NormalizeEmail trims, lowercases and validates an address.
+func NormalizeEmail(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	a, err := mail.ParseAddress(s)
+	if err != nil || a.Address != s || !strings.Contains(s[strings.LastIndex(s, "@")+1:], ".") { return "", ErrInvalidEmail }
+	return s, nil
+}
+
+// ValidatePassword enforces the strength rules for new passwords.
+func ValidatePassword(plain, email string) error {
+	if n := len([]rune(plain)); n < minPasswordLen || n > maxPasswordLen { return ErrWeakPassword }
+	var letters, others bool
+	for _, r := range plain {
+		if unicode.IsLetter(r) { letters = true } else if !unicode.IsSpace(r) { others = true }
+	}
+	if !letters || !others { return ErrWeakPassword }
+	if local, _, ok := strings.Cut(email, "@"); ok && len(local) >= 4 && strings.Contains(strings.ToLower(plain), local) {
+		return errors.New("password must not contain your email")
+	}
+	return nil
+}
+
+func hashPassword(plain string) (string, error) {
+	salt := make([]byte, argonSaltLen)
+	if _, err := rand.Read(salt); err != nil { return "", err }
+	key := argon2.IDKey([]byte(plain), salt, argonTime, argonMemory, argonThreads, argonKeyLen)
+	b64 := base64.RawStdEncoding
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s", argon2.Version, argonMemory, argonTime, argonThreads, b64.EncodeToString(salt), b64.EncodeToString(key)), nil
+}
+
+// checkPassword verifies plain against an argon2id or legacy bcrypt hash.
+// needsRehash is true when the hash should be replaced with a fresh argon2id one.
+func checkPassword(plain, storedHash string) (ok, needsRehash bool) {
+	switch {
+	case strings.HasPrefix(storedHash, "$argon2id$"):
+		p, err := parseArgon2(storedHash)
+		if err != nil { return false, false }
+		key := argon2.IDKey([]byte(plain), p.salt, p.time, p.memory, p.threads, uint32(len(p.key)))
+		if subtle.ConstantTimeCompare(key, p.key) != 1 { return false, false }
+		return true, p.time != argonTime || p.memory != argonMemory || p.threads != argonThreads || uint32(len(p.key)) != argonKeyLen
+	case strings.HasPrefix(storedHash, "$2a$"), strings.HasPrefix(storedHash, "$2b$"), strings.HasPrefix(storedHash, "$2y$"):
+		if bcrypt.CompareHashAndPassword([]byte(storedHash), []byte(plain)) != nil { return false, false }
+		return true, true
+	}
+	return false, false
+}
+
+type argon2Params struct {
+	time, memory uint32
+	threads      uint8
+	salt, key    []byte
+}
+
+func parseArgon2(h string) (*argon2Params, error) {
+	parts := strings.Split(h, "$") // "", argon2id, v=19, m=..,t=..,p=.., salt, key
+	if len(parts) != 6 { return nil, errors.New("malformed hash") }
+	var v int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &v); err != nil || v != argon2.Version { return nil, errors.New("unsupported argon2 version") }
+	p := &argon2Params{}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &p.memory, &p.time, &p.threads); err != nil { return nil, err }
+	var err error
+	if p.salt, err = base64.RawStdEncoding.DecodeString(parts[4]); err != nil { return nil, err }
+	if p.key, err = base64.RawStdEncoding.DecodeString(parts[5]); err != nil { return nil, err }
+	return p, nil
+}
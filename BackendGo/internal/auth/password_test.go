@@ -0,0 +1,43 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashAndCheckPassword(t *testing.T) {
+	h, err := hashPassword("correct horse 42")
+	if err != nil { t.Fatal(err) }
+	if !strings.HasPrefix(h, "$argon2id$") { t.Fatalf("unexpected format %q", h) }
+	if ok, rehash := checkPassword("correct horse 42", h); !ok || rehash { t.Fatalf("ok=%v rehash=%v", ok, rehash) }
+	if ok, _ := checkPassword("wrong horse 42", h); ok { t.Fatal("wrong password accepted") }
+	if ok, _ := checkPassword("anything", ""); ok { t.Fatal("empty hash accepted") }
+}
+
+func TestLegacyBcryptNeedsRehash(t *testing.T) {
+	b, _ := bcrypt.GenerateFromPassword([]byte("legacy-pass-1"), bcrypt.MinCost)
+	if ok, rehash := checkPassword("legacy-pass-1", string(b)); !ok || !rehash { t.Fatalf("ok=%v rehash=%v", ok, rehash) }
+	if ok, _ := checkPassword("legacy-pass-2", string(b)); ok { t.Fatal("wrong password accepted") }
+}
+
+func TestValidatePassword(t *testing.T) {
+	cases := map[string]bool{
+		"short1":              false,
+		"onlyletterslong":     false,
+		"12345678901":         false,
+		"letters and 1 digit": true,
+		"alice-secret-9":      false, // contains the email local part
+	}
+	for pw, want := range cases {
+		if got := ValidatePassword(pw, "alice@example.com") == nil; got != want { t.Errorf("%q: got %v want %v", pw, got, want) }
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	if e, err := NormalizeEmail("  Bob@Example.COM "); err != nil || e != "bob@example.com" { t.Fatalf("got %q %v", e, err) }
+	for _, bad := range []string{"", "bob", "bob@localhost", "Bob <bob@example.com>"} {
+		if _, err := NormalizeEmail(bad); err == nil { t.Errorf("%q should be rejected", bad) }
+	}
+}
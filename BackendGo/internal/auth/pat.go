@@ -0,0 +1,160 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"go-chat-backend/internal/store"
+)
+
+// Personal access tokens look like "gcp_<8 hex id>_<secret>". The prefix
+// part is stored in clear so a token can be found (and recognised in logs)
+// without storing the secret; only its hash is kept.
+const patPrefix = "gcp_"
+
+// Scopes a personal access token may be granted. Each resource has a read
+// and a write scope; see httputil.RequireScope.
+var PATScopes = []string{
+	"messages:read", "messages:write",
+	"conversations:read", "conversations:write",
+	"contacts:read", "contacts:write",
+}
+
+const (
+	patMaxLifetime     = 365 * 24 * time.Hour
+	patDefaultLifetime = 30 * 24 * time.Hour
+)
+
+var (
+	ErrInvalidPAT  = errors.New("invalid access token")
+	ErrPATNotFound = errors.New("token not found")
+)
+
+// IsPAT reports whether a bearer credential is a personal access token.
+func IsPAT(tok string) bool { return strings.HasPrefix(tok, patPrefix) }
+
+type PAT struct {
+	ID         string     `db:"id" json:"id"`
+	Name       string     `db:"name" json:"name"`
+	Prefix     string     `db:"prefix" json:"prefix"`
+	Scopes     []string   `db:"-" json:"scopes"`
+	RawScopes  string     `db:"scopes" json:"-"`
+	CreatedAt  time.Time  `db:"created_at" json:"created_at"`
+	LastUsedAt *time.Time `db:"last_used_at" json:"last_used_at"`
+	ExpiresAt  *time.Time `db:"expires_at" json:"expires_at"`
+}
+
+type PATs struct{ st *store.Store }
+
+func NewPATs(st *store.Store) *PATs { return &PATs{st: st} }
+
+// Create issues a token; the returned plain value is never retrievable again.
+// Every token expires: a zero ttl means patDefaultLifetime.
+func (p *PATs) Create(userID, name string, scopes []string, ttl time.Duration) (*PAT, string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" || len(name) > 100 { return nil, "", errors.New("name must be 1-100 characters") }
+	scopes, err := normalizeScopes(scopes)
+	if err != nil { return nil, "", err }
+	if ttl == 0 { ttl = patDefaultLifetime }
+	if ttl < 0 || ttl > patMaxLifetime { return nil, "", fmt.Errorf("lifetime must be at most %d days", int(patMaxLifetime/(24*time.Hour))) }
+
+	idb := make([]byte, 4)
+	if _, err := rand.Read(idb); err != nil { return nil, "", err }
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil { return nil, "", err }
+	prefix := patPrefix + hex.EncodeToString(idb)
+	plain := prefix + "_" + base64.RawURLEncoding.EncodeToString(secret)
+
+	expires := time.Now().UTC().Add(ttl)
+	t := &PAT{Name: name, Prefix: prefix, Scopes: scopes, ExpiresAt: &expires}
+	err = p.st.DB.QueryRowx(`INSERT INTO personal_access_tokens(user_id, name, prefix, token_hash, scopes, expires_at)
+		VALUES($1,$2,$3,$4,$5,$6) RETURNING id, created_at`, userID, name, prefix, HashToken(plain), strings.Join(scopes, " "), expires).Scan(&t.ID, &t.CreatedAt)
+	if err != nil { return nil, "", err }
+	return t, plain, nil
+}
+
+func (p *PATs) List(userID string) ([]PAT, error) {
+	var out []PAT
+	err := p.st.DB.Select(&out, `SELECT id, name, prefix, scopes, created_at, last_used_at, expires_at FROM personal_access_tokens
+		WHERE user_id=$1 AND revoked_at IS NULL ORDER BY created_at DESC`, userID)
+	for i := range out { out[i].Scopes = strings.Fields(out[i].RawScopes) }
+	return out, err
+}
+
+func (p *PATs) Revoke(userID, id string) error {
+	res, err := p.st.DB.Exec(`UPDATE personal_access_tokens SET revoked_at=now() WHERE id::text=$1 AND user_id=$2 AND revoked_at IS NULL`, id, userID)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return ErrPATNotFound }
+	return nil
+}
+
+// patRow is a stored token with everything that decides whether it may
+// still be used.
+type patRow struct {
+	ID         string     `db:"id"`
+	UserID     string     `db:"user_id"`
+	Email      string     `db:"email"`
+	Hash       string     `db:"token_hash"`
+	Scopes     string     `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+	ValidAfter *time.Time `db:"tokens_valid_after"`
+	Closing    bool       `db:"closing"` // account deleted or pending deletion
+}
+
+// usable reports whether plain is this token and it is still live at now.
+func (r *patRow) usable(plain string, now time.Time) bool {
+	switch {
+	case subtle.ConstantTimeCompare([]byte(r.Hash), []byte(HashToken(plain))) != 1,
+		r.RevokedAt != nil, r.Closing,
+		r.ExpiresAt == nil || now.After(*r.ExpiresAt),
+		r.ValidAfter != nil && r.CreatedAt.Before(*r.ValidAfter):
+		return false
+	}
+	return true
+}
+
+// Authenticate resolves a presented token to claims restricted to its scopes.
+// Tokens of accounts pending deletion are refused, as are tokens created
+// before the user's last "log out everywhere" (RevokeAll also revokes them).
+func (p *PATs) Authenticate(plain string) (*Claims, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(plain, patPrefix), "_")
+	if !IsPAT(plain) || !ok { return nil, ErrInvalidPAT }
+	var r patRow
+	err := p.st.DB.QueryRowx(`SELECT t.id, t.user_id, u.email, t.token_hash, t.scopes, t.created_at, t.expires_at, t.revoked_at, u.tokens_valid_after,
+		u.deleted_at IS NOT NULL OR u.deletion_scheduled_for IS NOT NULL AS closing
+		FROM personal_access_tokens t JOIN users u ON u.id=t.user_id WHERE t.prefix=$1`, patPrefix+prefix).StructScan(&r)
+	if errors.Is(err, sql.ErrNoRows) { return nil, ErrInvalidPAT }
+	if err != nil { return nil, err }
+	if !r.usable(plain, time.Now()) { return nil, ErrInvalidPAT }
+	_, _ = p.st.DB.Exec(`UPDATE personal_access_tokens SET last_used_at=now() WHERE id=$1 AND (last_used_at IS NULL OR last_used_at < now() - interval '1 minute')`, r.ID)
+	// No Role: moderator and admin powers are never delegated to tokens.
+	c := &Claims{UserID: r.UserID, Email: r.Email, Scopes: strings.Fields(r.Scopes)}
+	c.ID = "pat:" + r.ID
+	return c, nil
+}
+
+func normalizeScopes(in []string) ([]string, error) {
+	seen := map[string]bool{}
+	for _, s := range in {
+		s = strings.TrimSpace(s)
+		valid := false
+		for _, v := range PATScopes { if v == s { valid = true; break } }
+		if !valid { return nil, fmt.Errorf("unknown scope %q", s) }
+		seen[s] = true
+	}
+	if len(seen) == 0 { return nil, errors.New("at least one scope is required") }
+	out := make([]string, 0, len(seen))
+	for s := range seen { out = append(out, s) }
+	sort.Strings(out)
+	return out, nil
+}
@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestIsPAT(t *testing.T) {
+	cases := map[string]bool{
+		"gcp_0a1b2c3d_secret":  true,
+		"gcp_":                 true,
+		"GCP_0a1b2c3d_secret":  false,
+		"eyJhbGciOiJFZERTQSJ9": false,
+		"xgcp_0a1b2c3d_secret": false,
+		"":                     false,
+	}
+	for tok, want := range cases {
+		if got := IsPAT(tok); got != want { t.Errorf("IsPAT(%q) = %v", tok, got) }
+	}
+}
+
+func TestNormalizeScopes(t *testing.T) {
+	cases := []struct {
+		in      []string
+		want    []string
+		wantErr bool
+	}{
+		{[]string{"messages:write", "contacts:read"}, []string{"contacts:read", "messages:write"}, false},
+		{[]string{"messages:read", " messages:read ", "messages:read"}, []string{"messages:read"}, false},
+		{[]string{"messages:read", "admin"}, nil, true},
+		{[]string{"Messages:Read"}, nil, true},
+		{[]string{""}, nil, true},
+		{nil, nil, true},
+	}
+	for _, c := range cases {
+		got, err := normalizeScopes(c.in)
+		if (err != nil) != c.wantErr || !reflect.DeepEqual(got, c.want) { t.Errorf("normalizeScopes(%q) = %v, %v", c.in, got, err) }
+	}
+}
+
+func TestPATUsable(t *testing.T) {
+	now := time.Now()
+	past, future := now.Add(-time.Hour), now.Add(time.Hour)
+	const plain = "gcp_0a1b2c3d_secret"
+	live := func() patRow { return patRow{Hash: HashToken(plain), CreatedAt: past.Add(-time.Hour), ExpiresAt: &future} }
+	cases := []struct {
+		name  string
+		edit  func(*patRow)
+		plain string
+		want  bool
+	}{
+		{"live", func(*patRow) {}, plain, true},
+		{"wrong secret", func(*patRow) {}, "gcp_0a1b2c3d_other", false},
+		{"expired", func(r *patRow) { r.ExpiresAt = &past }, plain, false},
+		{"no expiry", func(r *patRow) { r.ExpiresAt = nil }, plain, false},
+		{"revoked", func(r *patRow) { r.RevokedAt = &past }, plain, false},
+		{"logged out everywhere since", func(r *patRow) { r.ValidAfter = &past }, plain, false},
+		{"created after log out everywhere", func(r *patRow) { v := past.Add(-2 * time.Hour); r.ValidAfter = &v }, plain, true},
+		{"account closing", func(r *patRow) { r.Closing = true }, plain, false},
+	}
+	for _, c := range cases {
+		r := live()
+		c.edit(&r)
+		if got := r.usable(c.plain, now); got != c.want { t.Errorf("%s: usable = %v", c.name, got) }
+	}
+}
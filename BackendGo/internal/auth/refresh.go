@@ -0,0 +1,57 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrInvalidRefresh = errors.New("invalid refresh token")
+	ErrRefreshReuse   = errors.New("refresh token reuse detected")
+)
+
+// newRefreshToken stores a refresh token for the session. Each session is
+// its own rotation family.
+func (s *Service) newRefreshToken(userID, sessionID string) (string, error) {
+	plain, hash, err := NewOpaqueToken()
+	if err != nil { return "", err }
+	_, err = s.st.DB.Exec(`INSERT INTO refresh_tokens(user_id, session_id, family_id, token_hash, expires_at)
+		VALUES($1,$2,$2,$3,$4)`, userID, sessionID, hash, time.Now().UTC().Add(s.cfg.RefreshTTL))
+	if err != nil { return "", err }
+	return plain, nil
+}
+
+// Rotate consumes a refresh token and returns a replacement in the same family.
+// Presenting an already-used token revokes the whole session, since either the
+// legitimate client or an attacker is holding a stolen copy.
+func (s *Service) Rotate(plain string) (sub subject, next string, err error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return sub, "", err }
+	defer tx.Rollback()
+
+	var (
+		id              string
+		expiresAt       time.Time
+		usedAt, revoked *time.Time
+	)
+	err = tx.QueryRowx(`SELECT r.id, r.user_id, r.session_id, r.expires_at, r.used_at, r.revoked_at, u.email, u.role
+		FROM refresh_tokens r JOIN users u ON u.id=r.user_id WHERE r.token_hash=$1 FOR UPDATE OF r`, HashToken(plain)).
+		Scan(&id, &sub.UserID, &sub.SessionID, &expiresAt, &usedAt, &revoked, &sub.Email, &sub.Role)
+	if errors.Is(err, sql.ErrNoRows) { return sub, "", ErrInvalidRefresh }
+	if err != nil { return sub, "", err }
+	if revoked != nil || time.Now().After(expiresAt) { return sub, "", ErrInvalidRefresh }
+	if usedAt != nil {
+		tx.Rollback()
+		if err := s.rev.RevokeSession(sub.UserID, sub.SessionID); err != nil && !errors.Is(err, ErrSessionNotFound) { return sub, "", err }
+		return sub, "", ErrRefreshReuse
+	}
+
+	nextPlain, nextHash, err := NewOpaqueToken()
+	if err != nil { return sub, "", err }
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET used_at=now() WHERE id=$1`, id); err != nil { return sub, "", err }
+	if _, err := tx.Exec(`INSERT INTO refresh_tokens(user_id, session_id, family_id, token_hash, expires_at) VALUES($1,$2,$2,$3,$4)`,
+		sub.UserID, sub.SessionID, nextHash, time.Now().UTC().Add(s.cfg.RefreshTTL)); err != nil { return sub, "", err }
+	if _, err := tx.Exec(`UPDATE sessions SET last_seen_at=now() WHERE id=$1`, sub.SessionID); err != nil { return sub, "", err }
+	return sub, nextPlain, tx.Commit()
+}
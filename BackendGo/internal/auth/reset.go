@@ -0,0 +1,73 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"time"
+
+	"go-chat-backend/internal/mail"
+)
+
+const (
+	resetTTL      = time.Hour
+	resetThrottle = time.Minute // minimum gap between reset mails for one account
+)
+
+var ErrInvalidResetToken = errors.New("invalid or expired reset token")
+
+// RequestPasswordReset mails a single-use reset link if email belongs to an
+// account. It reports nothing about whether the account exists.
+func (s *Service) RequestPasswordReset(email string) error {
+	var userID string
+	err := s.st.DB.QueryRowx(`SELECT id FROM users WHERE email=$1`, email).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) { return nil }
+	if err != nil { return err }
+
+	var recent bool
+	if err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM password_resets WHERE user_id=$1 AND created_at > $2)`,
+		userID, time.Now().UTC().Add(-resetThrottle)).Scan(&recent); err != nil { return err }
+	if recent { return nil }
+
+	plain, hash, err := NewOpaqueToken()
+	if err != nil { return err }
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	// Only the newest link works.
+	if _, err := tx.Exec(`UPDATE password_resets SET used_at=now() WHERE user_id=$1 AND used_at IS NULL`, userID); err != nil { return err }
+	if _, err := tx.Exec(`INSERT INTO password_resets(user_id, token_hash, expires_at) VALUES($1,$2,$3)`,
+		userID, hash, time.Now().UTC().Add(resetTTL)); err != nil { return err }
+	if err := tx.Commit(); err != nil { return err }
+
+	link := s.cfg.AppURL + "/reset-password?token=" + url.QueryEscape(plain)
+	msg := mail.Message{To: email, Subject: "Reset your password", Body: fmt.Sprintf(
+		"Someone asked to reset the password for this account.\n\nOpen this link within %d minutes to choose a new one:\n%s\n\nIf it wasn't you, ignore this email.\n",
+		int(resetTTL/time.Minute), link)}
+	// Delivered in the background so response time does not reveal whether the account exists.
+	go func() { if err := s.mailer.Send(msg); err != nil { log.Printf("password reset mail: %v", err) } }()
+	return nil
+}
+
+// ConfirmPasswordReset sets a new password using a reset token and signs the
+// user out everywhere.
+func (s *Service) ConfirmPasswordReset(token, password string) error {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+
+	var resetID, userID, email string
+	err = tx.QueryRowx(`SELECT r.id, r.user_id, u.email FROM password_resets r JOIN users u ON u.id=r.user_id
+		WHERE r.token_hash=$1 AND r.used_at IS NULL AND r.expires_at > now() FOR UPDATE OF r`, HashToken(token)).Scan(&resetID, &userID, &email)
+	if errors.Is(err, sql.ErrNoRows) { return ErrInvalidResetToken }
+	if err != nil { return err }
+	if err := ValidatePassword(password, email); err != nil { return err }
+	ph, err := hashPassword(password)
+	if err != nil { return err }
+	if _, err := tx.Exec(`UPDATE users SET password_hash=$1 WHERE id=$2`, ph, userID); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE password_resets SET used_at=now() WHERE id=$1`, resetID); err != nil { return err }
+	if err := tx.Commit(); err != nil { return err }
+	return s.rev.RevokeAll(userID)
+}
@@ -0,0 +1,125 @@
+package auth
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go-chat-backend/internal/store"
+)
+
+var ErrTokenRevoked = errors.New("token revoked")
+
+// Revocation describes a token (JTI), a session, or, when All is set, every
+// token of a user that has just been revoked. Listeners use it to drop live
+// connections.
+type Revocation struct {
+	JTI       string
+	SessionID string
+	UserID    string
+	All       bool
+}
+
+// Revoker kills access tokens before their expiry. Single tokens are listed
+// by JTI until they would have expired anyway; "log out everywhere" moves the
+// user's tokens_valid_after forward so older tokens fail the IssuedAt check.
+type Revoker struct {
+	st        *store.Store
+	mu        sync.RWMutex
+	listeners []func(Revocation)
+	seen      map[string]time.Time // session id -> last last_seen_at write
+}
+
+func NewRevoker(st *store.Store) *Revoker { return &Revoker{st: st, seen: make(map[string]time.Time)} }
+
+// sessionTouchEvery throttles last_seen_at writes to one per session per interval.
+const sessionTouchEvery = time.Minute
+
+// Subscribe registers fn to be called after every successful revocation.
+func (rv *Revoker) Subscribe(fn func(Revocation)) {
+	rv.mu.Lock(); defer rv.mu.Unlock()
+	rv.listeners = append(rv.listeners, fn)
+}
+
+func (rv *Revoker) notify(ev Revocation) {
+	rv.mu.RLock(); ls := rv.listeners; rv.mu.RUnlock()
+	for _, fn := range ls { fn(ev) }
+}
+
+// Check returns ErrTokenRevoked if the token was revoked individually, its
+// session was ended, or it was issued before the user's last "log out
+// everywhere". Passing tokens mark their session as recently seen.
+func (rv *Revoker) Check(c *Claims) error {
+	var (
+		revoked, sessionEnded bool
+		validAfter            *time.Time
+	)
+	err := rv.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM revoked_tokens WHERE jti=$1),
+		(SELECT tokens_valid_after FROM users WHERE id=$2),
+		$3::text <> '' AND NOT EXISTS(SELECT 1 FROM sessions WHERE id=NULLIF($3::text,'')::uuid AND revoked_at IS NULL)`, c.ID, c.UserID, c.SessionID).Scan(&revoked, &validAfter, &sessionEnded)
+	if err != nil { return err }
+	if revoked || sessionEnded { return ErrTokenRevoked }
+	if validAfter != nil && (c.IssuedAt == nil || c.IssuedAt.Time.Before(*validAfter)) { return ErrTokenRevoked }
+	if c.SessionID != "" { rv.touch(c.SessionID) }
+	return nil
+}
+
+func (rv *Revoker) touch(sessionID string) {
+	now := time.Now()
+	rv.mu.Lock()
+	if now.Sub(rv.seen[sessionID]) < sessionTouchEvery { rv.mu.Unlock(); return }
+	if len(rv.seen) > 100000 { rv.seen = make(map[string]time.Time) }
+	rv.seen[sessionID] = now
+	rv.mu.Unlock()
+	_, _ = rv.st.DB.Exec(`UPDATE sessions SET last_seen_at=now() WHERE id=$1`, sessionID)
+}
+
+// RevokeSession ends one of userID's sessions along with its tokens.
+func (rv *Revoker) RevokeSession(userID, sessionID string) error {
+	tx, err := rv.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	res, err := tx.Exec(`UPDATE sessions SET revoked_at=now() WHERE id::text=$1 AND user_id=$2 AND revoked_at IS NULL`, sessionID, userID)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return ErrSessionNotFound }
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at=now() WHERE session_id=$1 AND revoked_at IS NULL`, sessionID); err != nil { return err }
+	if err := tx.Commit(); err != nil { return err }
+	rv.mu.Lock(); delete(rv.seen, sessionID); rv.mu.Unlock()
+	rv.notify(Revocation{SessionID: sessionID, UserID: userID})
+	return nil
+}
+
+// Revoke invalidates a single access token.
+func (rv *Revoker) Revoke(c *Claims) error {
+	if c.ID == "" || c.ExpiresAt == nil { return errors.New("token cannot be revoked") }
+	_, err := rv.st.DB.Exec(`INSERT INTO revoked_tokens(jti, user_id, expires_at) VALUES($1,$2,$3) ON CONFLICT (jti) DO NOTHING`, c.ID, c.UserID, c.ExpiresAt.Time)
+	if err != nil { return err }
+	rv.notify(Revocation{JTI: c.ID, UserID: c.UserID})
+	return nil
+}
+
+// RevokeAll invalidates every access and refresh token and every personal
+// access token issued to userID so far.
+func (rv *Revoker) RevokeAll(userID string) error {
+	tx, err := rv.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	// IssuedAt has second precision, so truncate to keep tokens minted right after this call valid.
+	if _, err := tx.Exec(`UPDATE users SET tokens_valid_after=date_trunc('second', now()) WHERE id=$1`, userID); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE refresh_tokens SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, userID); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE sessions SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, userID); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE personal_access_tokens SET revoked_at=now() WHERE user_id=$1 AND revoked_at IS NULL`, userID); err != nil { return err }
+	if err := tx.Commit(); err != nil { return err }
+	rv.notify(Revocation{UserID: userID, All: true})
+	return nil
+}
+
+// StartRevocationPurger drops revocation entries for tokens that have expired.
+func StartRevocationPurger(db *sqlx.DB, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		_, _ = db.Exec(`DELETE FROM revoked_tokens WHERE expires_at < now()`)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+)
+
+// Global roles, from least to most privileged.
+const (
+	RoleUser      = "user"
+	RoleModerator = "moderator"
+	RoleAdmin     = "admin"
+)
+
+var roleRank = map[string]int{RoleUser: 1, RoleModerator: 2, RoleAdmin: 3}
+
+// ValidRole reports whether r is one of the known roles.
+func ValidRole(r string) bool { return roleRank[r] > 0 }
+
+// HasRole reports whether role grants at least the privileges of min.
+// Unknown or empty roles (e.g. tokens minted before roles existed) count as user.
+func HasRole(role, min string) bool {
+	r := roleRank[role]
+	if r == 0 { r = roleRank[RoleUser] }
+	return r >= roleRank[min]
+}
+
+var (
+	ErrInvalidRole  = errors.New("role must be user, moderator or admin")
+	ErrUserNotFound = errors.New("user not found")
+	ErrOwnRole      = errors.New("you cannot change your own role")
+)
+
+// SetRole changes userID's role on behalf of actorID. Promotions apply on
+// the user's next refresh; demotions revoke every token so elevated access
+// ends immediately. Admins cannot change their own role, which also keeps
+// the last admin from locking everyone out.
+func (s *Service) SetRole(actorID, userID, role string) error {
+	if !ValidRole(role) { return ErrInvalidRole }
+	if actorID == userID { return ErrOwnRole }
+	var old string
+	err := s.st.DB.QueryRowx(`SELECT role FROM users WHERE id=$1`, userID).Scan(&old)
+	if errors.Is(err, sql.ErrNoRows) { return ErrUserNotFound }
+	if err != nil { return err }
+	if old == role { return nil }
+	if _, err := s.st.DB.Exec(`UPDATE users SET role=$2 WHERE id=$1`, userID, role); err != nil { return err }
+	log.Printf("role change: %s set %s from %s to %s", actorID, userID, old, role)
+	if !HasRole(role, old) { return s.rev.RevokeAll(userID) }
+	return nil
+}
+
+// BootstrapAdmin promotes the account with the given email to admin. It is
+// how the first admin is created (ADMIN_EMAIL); unknown emails are ignored
+// so the variable can be set before that user registers.
+func (s *Service) BootstrapAdmin(email string) error {
+	email, err := NormalizeEmail(email)
+	if err != nil { return err }
+	_, err = s.st.DB.Exec(`UPDATE users SET role='admin' WHERE email=$1 AND role<>'admin'`, email)
+	return err
+}
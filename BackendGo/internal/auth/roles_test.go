@@ -0,0 +1,23 @@
+package auth
+
+import "testing"
+
+func TestHasRole(t *testing.T) {
+	cases := []struct {
+		role, min string
+		want      bool
+	}{
+		{RoleUser, RoleUser, true},
+		{RoleUser, RoleModerator, false},
+		{RoleModerator, RoleModerator, true},
+		{RoleModerator, RoleAdmin, false},
+		{RoleAdmin, RoleModerator, true},
+		{"", RoleUser, true},
+		{"", RoleModerator, false},
+		{"superuser", RoleModerator, false},
+	}
+	for _, c := range cases {
+		if got := HasRole(c.role, c.min); got != c.want { t.Errorf("HasRole(%q, %q) = %v, want %v", c.role, c.min, got, c.want) }
+	}
+	if ValidRole("") || ValidRole("root") || !ValidRole(RoleAdmin) { t.Error("ValidRole accepts unknown roles") }
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"errors"
+	"time"
+
+	"go-chat-backend/internal/mail"
+	"go-chat-backend/internal/oidc"
+	"go-chat-backend/internal/store"
+)
+
+type Config struct {
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	AppURL     string // base URL of the web client, used in mailed links
+	MFAIssuer  string // shown in authenticator apps
+
+	OIDC              *oidc.Provider // nil disables single sign-on
+	OIDCAutoProvision bool           // create accounts for unknown IdP users
+}
+
+type Service struct {
+	st     *store.Store
+	rev    *Revoker
+	mailer mail.Sender
+	cfg    Config
+}
+
+func NewService(st *store.Store, rev *Revoker, mailer mail.Sender, cfg Config) *Service {
+	if cfg.MFAIssuer == "" { cfg.MFAIssuer = "Go Chat" }
+	return &Service{st: st, rev: rev, mailer: mailer, cfg: cfg}
+}
+
+type TokenPair struct {
+	AccessToken  string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// subject is who an access token is issued to.
+type subject struct{ UserID, Email, Role, SessionID string }
+
+// issue opens a new session for the device and signs its first token pair.
+// Signing in during an account deletion's grace period cancels the deletion.
+func (s *Service) issue(jwt *JWT, sub subject, dev Device) (*TokenPair, error) {
+	if _, err := s.st.DB.Exec(`UPDATE users SET deletion_scheduled_for=NULL, deletion_mode=NULL WHERE id=$1 AND deletion_scheduled_for IS NOT NULL`, sub.UserID); err != nil { return nil, err }
+	sid, err := s.createSession(sub.UserID, dev)
+	if err != nil { return nil, err }
+	sub.SessionID = sid
+	rt, err := s.newRefreshToken(sub.UserID, sid)
+	if err != nil { return nil, err }
+	return s.pair(jwt, sub, rt)
+}
+
+// signIn finishes a first-factor login (password or single sign-on). With
+// two-factor authentication on, the answer is an mfa token to exchange at
+// /api/auth/login/mfa; this token is useless anywhere else.
+func (s *Service) signIn(jwt *JWT, sub subject, dev Device) (map[string]any, error) {
+	mfa, err := s.MFAEnabled(sub.UserID)
+	if err != nil { return nil, err }
+	if mfa {
+		mt, err := jwt.Sign(Claims{UserID: sub.UserID, Email: sub.Email, Role: sub.Role, Purpose: PurposeMFA}, mfaTokenTTL)
+		if err != nil { return nil, err }
+		return map[string]any{"mfa_required": true, "mfa_token": mt, "expires_in": int64(mfaTokenTTL / time.Second)}, nil
+	}
+	s.clearLoginFailures(sub.Email)
+	tp, err := s.issue(jwt, sub, dev)
+	if err != nil { return nil, err }
+	return tokenResp(tp, sub.UserID, sub.Email), nil
+}
+
+func (s *Service) pair(jwt *JWT, sub subject, refresh string) (*TokenPair, error) {
+	tok, err := jwt.Sign(Claims{UserID: sub.UserID, Email: sub.Email, Role: sub.Role, SessionID: sub.SessionID}, s.cfg.AccessTTL)
+	if err != nil { return nil, err }
+	return &TokenPair{AccessToken: tok, RefreshToken: refresh, ExpiresIn: int64(s.cfg.AccessTTL / time.Second)}, nil
+}
+
+var (
+	ErrWrongPassword  = errors.New("wrong password")
+	ErrReauthRequired = errors.New("sign in again to confirm this action")
+)
+
+// reauthWindow is how recent a sign-in must be to stand in for a password.
+const reauthWindow = 10 * time.Minute
+
+// Reauthenticate confirms a destructive action by the signed-in user c. With
+// a password that must be given; accounts without one (single sign-on only)
+// need a second-factor code or a session opened within reauthWindow.
+func (s *Service) Reauthenticate(c *Claims, password, code string) error {
+	var ph string
+	if err := s.st.DB.QueryRowx(`SELECT password_hash FROM users WHERE id=$1`, c.UserID).Scan(&ph); err != nil { return err }
+	if ph != "" {
+		if ok, _ := checkPassword(password, ph); !ok { return ErrWrongPassword }
+		return nil
+	}
+	if code != "" {
+		err := s.verifySecondFactor(c.UserID, code, "", nil)
+		if errors.Is(err, ErrMFANotEnabled) { return ErrInvalidCode }
+		return err
+	}
+	var fresh bool
+	err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM sessions WHERE id::text=$1 AND user_id=$2 AND revoked_at IS NULL AND created_at > $3)`,
+		c.SessionID, c.UserID, time.Now().Add(-reauthWindow)).Scan(&fresh)
+	if err != nil { return err }
+	if !fresh { return ErrReauthRequired }
+	return nil
+}
@@ -0,0 +1,69 @@
+package auth
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+)
+
+var ErrSessionNotFound = errors.New("session not found")
+
+// Device is what we record about the client a session was opened from.
+type Device struct{ Name, UserAgent, IP string }
+
+// DeviceFromRequest describes the caller; name is the client-supplied label
+// and falls back to a guess from the User-Agent.
+func DeviceFromRequest(r *http.Request, name string) Device {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil { ip = r.RemoteAddr }
+	ua := r.UserAgent()
+	if len(ua) > 512 { ua = ua[:512] }
+	name = strings.TrimSpace(name)
+	if name == "" { name = guessDevice(ua) }
+	if len(name) > 100 { name = name[:100] }
+	return Device{Name: name, UserAgent: ua, IP: ip}
+}
+
+func guessDevice(ua string) string {
+	l := strings.ToLower(ua)
+	var browser, os string
+	for _, b := range []struct{ key, name string }{{"edg/", "Edge"}, {"firefox/", "Firefox"}, {"chrome/", "Chrome"}, {"safari/", "Safari"}} {
+		if strings.Contains(l, b.key) { browser = b.name; break }
+	}
+	for _, o := range []struct{ key, name string }{{"android", "Android"}, {"iphone", "iOS"}, {"ipad", "iOS"}, {"windows", "Windows"}, {"mac os", "macOS"}, {"linux", "Linux"}} {
+		if strings.Contains(l, o.key) { os = o.name; break }
+	}
+	switch {
+	case browser != "" && os != "": return browser + " on " + os
+	case browser != "": return browser
+	case os != "": return os
+	}
+	return "Unknown device"
+}
+
+type Session struct {
+	ID         string    `db:"id" json:"id"`
+	DeviceName string    `db:"device_name" json:"device_name"`
+	UserAgent  string    `db:"user_agent" json:"user_agent"`
+	IP         string    `db:"ip" json:"ip"`
+	CreatedAt  time.Time `db:"created_at" json:"created_at"`
+	LastSeenAt time.Time `db:"last_seen_at" json:"last_seen_at"`
+	Current    bool      `db:"-" json:"current"`
+}
+
+func (s *Service) createSession(userID string, dev Device) (string, error) {
+	var id string
+	err := s.st.DB.QueryRowx(`INSERT INTO sessions(user_id, device_name, user_agent, ip) VALUES($1,$2,$3,$4) RETURNING id`,
+		userID, dev.Name, dev.UserAgent, dev.IP).Scan(&id)
+	return id, err
+}
+
+// ListSessions returns the user's active sessions, most recently used first.
+func (s *Service) ListSessions(userID string) ([]Session, error) {
+	var out []Session
+	err := s.st.DB.Select(&out, `SELECT id, device_name, user_agent, ip, created_at, last_seen_at FROM sessions
+		WHERE user_id=$1 AND revoked_at IS NULL ORDER BY last_seen_at DESC`, userID)
+	return out, err
+}
@@ -0,0 +1,46 @@
+package auth
+
+import (
+	"sync"
+	"time"
+)
+
+const TicketTTL = 30 * time.Second
+
+// Tickets are short-lived, single-use credentials for the WebSocket upgrade,
+// so bearer tokens never end up in URLs (and thus proxy/access logs).
+// They live in memory: a ticket must be redeemed on the instance that minted
+// it, which holds as long as /api/ws/ticket and /ws share a sticky backend.
+type Tickets struct {
+	mu sync.Mutex
+	m  map[string]ticket
+}
+
+type ticket struct {
+	claims  *Claims
+	convID  string
+	expires time.Time
+}
+
+func NewTickets() *Tickets { return &Tickets{m: make(map[string]ticket)} }
+
+// Issue mints a ticket for the caller, optionally bound to one conversation.
+func (t *Tickets) Issue(c *Claims, convID string) (string, error) {
+	plain, hash, err := NewOpaqueToken()
+	if err != nil { return "", err }
+	now := time.Now()
+	t.mu.Lock(); defer t.mu.Unlock()
+	for k, v := range t.m { if now.After(v.expires) { delete(t.m, k) } }
+	t.m[hash] = ticket{claims: c, convID: convID, expires: now.Add(TicketTTL)}
+	return plain, nil
+}
+
+// Redeem consumes a ticket. convID is empty if the ticket is not bound.
+func (t *Tickets) Redeem(plain string) (c *Claims, convID string, ok bool) {
+	h := HashToken(plain)
+	t.mu.Lock(); defer t.mu.Unlock()
+	tk, found := t.m[h]
+	delete(t.m, h)
+	if !found || time.Now().After(tk.expires) { return nil, "", false }
+	return tk.claims, tk.convID, true
+}
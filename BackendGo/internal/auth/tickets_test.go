@@ -0,0 +1,37 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTicketsSingleUse(t *testing.T) {
+	ts := NewTickets()
+	c := &Claims{UserID: "u1"}
+	plain, err := ts.Issue(c, "c1")
+	if err != nil { t.Fatal(err) }
+	got, conv, ok := ts.Redeem(plain)
+	if !ok || got != c || conv != "c1" { t.Fatalf("Redeem = %v, %q, %v", got, conv, ok) }
+	if _, _, ok := ts.Redeem(plain); ok { t.Error("ticket redeemed twice") }
+	if _, _, ok := ts.Redeem("nope"); ok { t.Error("unknown ticket redeemed") }
+}
+
+func TestTicketsExpire(t *testing.T) {
+	ts := NewTickets()
+	plain, err := ts.Issue(&Claims{UserID: "u1"}, "")
+	if err != nil { t.Fatal(err) }
+	h := HashToken(plain)
+	tk := ts.m[h]
+	tk.expires = time.Now().Add(-time.Second)
+	ts.m[h] = tk
+	if _, _, ok := ts.Redeem(plain); ok { t.Error("expired ticket redeemed") }
+	if _, found := ts.m[h]; found { t.Error("expired ticket kept after redeem") }
+
+	// Issuing sweeps expired tickets.
+	old, _ := ts.Issue(&Claims{UserID: "u2"}, "")
+	tk = ts.m[HashToken(old)]
+	tk.expires = time.Now().Add(-time.Second)
+	ts.m[HashToken(old)] = tk
+	if _, err := ts.Issue(&Claims{UserID: "u3"}, ""); err != nil { t.Fatal(err) }
+	if len(ts.m) != 1 { t.Errorf("%d tickets left after sweep, want 1", len(ts.m)) }
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B (SHA1), truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	for ts, want := range map[int64]string{59: "287082", 1111111109: "081804", 1234567890: "005924", 2000000000: "279037"} {
+		if got := totpCode(key, uint64(ts/30)); got != want { t.Errorf("t=%d: got %s want %s", ts, got, want) }
+	}
+}
+
+func TestVerifyTOTPSkew(t *testing.T) {
+	secret := b32.EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+	if step, ok := verifyTOTP(secret, "081804", now); !ok || step != 1111111109/30 { t.Fatalf("step=%d ok=%v", step, ok) }
+	if _, ok := verifyTOTP(secret, "081804", now.Add(30*time.Second)); !ok { t.Fatal("previous step should be accepted") }
+	if _, ok := verifyTOTP(secret, "081804", now.Add(90*time.Second)); ok { t.Fatal("code three steps old accepted") }
+	if _, ok := verifyTOTP(secret, "000000", now); ok { t.Fatal("wrong code accepted") }
+}
+
+func TestOtpauthURI(t *testing.T) {
+	u := otpauthURI("Go Chat", "bob@example.com", "ABC")
+	if !strings.HasPrefix(u, "otpauth://totp/Go%20Chat:bob@example.com?") || !strings.Contains(u, "secret=ABC") { t.Fatal(u) }
+}
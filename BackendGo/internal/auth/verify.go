@@ -0,0 +1,74 @@
+package auth
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"go-chat-backend/internal/mail"
+)
+
+const (
+	verifyTTL      = 48 * time.Hour
+	verifyMinGap   = time.Minute // between two verification mails
+	verifyDailyMax = 5
+)
+
+var (
+	ErrInvalidVerifyToken = errors.New("invalid or expired verification token")
+	ErrAlreadyVerified    = errors.New("email already verified")
+)
+
+// ThrottledError means the caller must wait RetryAfter before trying again.
+type ThrottledError struct{ RetryAfter time.Duration }
+
+func (e *ThrottledError) Error() string { return fmt.Sprintf("too many requests, retry in %s", e.RetryAfter.Round(time.Second)) }
+
+// SendVerification mails a fresh verification link, limited to one mail per
+// minute and verifyDailyMax per day.
+func (s *Service) SendVerification(userID string) error {
+	var (
+		email    string
+		verified *time.Time
+	)
+	if err := s.st.DB.QueryRowx(`SELECT email, email_verified_at FROM users WHERE id=$1`, userID).Scan(&email, &verified); err != nil { return err }
+	if verified != nil { return ErrAlreadyVerified }
+
+	var (
+		sentToday   int
+		first, last *time.Time
+	)
+	if err := s.st.DB.QueryRowx(`SELECT count(*), min(created_at), max(created_at) FROM email_verifications WHERE user_id=$1 AND created_at > now() - interval '24 hours'`,
+		userID).Scan(&sentToday, &first, &last); err != nil { return err }
+	if last != nil {
+		if wait := verifyMinGap - time.Since(*last); wait > 0 { return &ThrottledError{RetryAfter: wait} }
+		// The window frees up when its oldest mail turns 24 hours old.
+		if sentToday >= verifyDailyMax { return &ThrottledError{RetryAfter: 24*time.Hour - time.Since(*first)} }
+	}
+
+	plain, hash, err := NewOpaqueToken()
+	if err != nil { return err }
+	if _, err := s.st.DB.Exec(`INSERT INTO email_verifications(user_id, token_hash, expires_at) VALUES($1,$2,$3)`,
+		userID, hash, time.Now().UTC().Add(verifyTTL)); err != nil { return err }
+	link := s.cfg.AppURL + "/verify-email?token=" + url.QueryEscape(plain)
+	return s.mailer.Send(mail.Message{To: email, Subject: "Confirm your email address", Body: fmt.Sprintf(
+		"Welcome to Go Chat!\n\nConfirm your email address so your colleagues can add you as a contact:\n%s\n\nThe link expires in %d hours.\n",
+		link, int(verifyTTL/time.Hour))})
+}
+
+// VerifyEmail marks the address behind token as verified.
+func (s *Service) VerifyEmail(token string) error {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	var userID string
+	err = tx.QueryRowx(`SELECT user_id FROM email_verifications WHERE token_hash=$1 AND used_at IS NULL AND expires_at > now() FOR UPDATE`,
+		HashToken(token)).Scan(&userID)
+	if errors.Is(err, sql.ErrNoRows) { return ErrInvalidVerifyToken }
+	if err != nil { return err }
+	if _, err := tx.Exec(`UPDATE email_verifications SET used_at=now() WHERE user_id=$1 AND used_at IS NULL`, userID); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE users SET email_verified_at=COALESCE(email_verified_at, now()) WHERE id=$1`, userID); err != nil { return err }
+	return tx.Commit()
+}
@@ -0,0 +1,69 @@
+package contacts
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"go-chat-backend/internal/store"
+)
+
+var (
+	ErrBlocked    = errors.New("you blocked this user; unblock them first")
+	ErrBlockSelf  = errors.New("you cannot block yourself")
+	ErrNotBlocked = errors.New("user is not blocked")
+)
+
+// BlockedBetween is the SQL condition "a block exists between a and b" in
+// either direction, for columns or parameters a and b. Blocked users see
+// each other as strangers everywhere.
+func BlockedBetween(a, b string) string {
+	return `EXISTS(SELECT 1 FROM user_blocks WHERE (blocker_id=` + a + ` AND blocked_id=` + b + `) OR (blocker_id=` + b + ` AND blocked_id=` + a + `))`
+}
+
+// Block stops blocked from contacting blocker: the contact rows between them
+// are removed in both directions and neither can add the other again until
+// the block is lifted.
+func (s *Service) Block(blocker, blocked string) error {
+	if blocker == blocked { return ErrBlockSelf }
+	if !store.IsUUID(blocked) { return ErrUserNotFound }
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	var x int
+	err = tx.QueryRowx(`SELECT 1 FROM users WHERE id=$1 AND deleted_at IS NULL`, blocked).Scan(&x)
+	if errors.Is(err, sql.ErrNoRows) { return ErrUserNotFound }
+	if err != nil { return err }
+	if _, err := tx.Exec(`INSERT INTO user_blocks(blocker_id, blocked_id, created_at) VALUES($1,$2,$3) ON CONFLICT DO NOTHING`, blocker, blocked, time.Now().UTC()); err != nil { return err }
+	if _, err := tx.Exec(`DELETE FROM contacts WHERE (owner_id=$1 AND contact_id=$2) OR (owner_id=$2 AND contact_id=$1)`, blocker, blocked); err != nil { return err }
+	if _, err := tx.Exec(`UPDATE contact_requests SET status='cancelled', responded_at=now() WHERE status='pending'
+		AND ((requester_id=$1 AND recipient_id=$2) OR (requester_id=$2 AND recipient_id=$1))`, blocker, blocked); err != nil { return err }
+	return tx.Commit()
+}
+
+func (s *Service) Unblock(blocker, blocked string) error {
+	if !store.IsUUID(blocked) { return ErrNotBlocked }
+	res, err := s.st.DB.Exec(`DELETE FROM user_blocks WHERE blocker_id=$1 AND blocked_id=$2`, blocker, blocked)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return ErrNotBlocked }
+	return nil
+}
+
+// Blocked reports whether a block exists between a and b in either direction.
+func (s *Service) Blocked(a, b string) (bool, error) {
+	var blocked bool
+	err := s.st.DB.QueryRowx(`SELECT `+BlockedBetween("$1", "$2"), a, b).Scan(&blocked)
+	return blocked, err
+}
+
+type BlockedUser struct {
+	UserID    string    `db:"blocked_id" json:"user_id"`
+	BlockedAt time.Time `db:"created_at" json:"blocked_at"`
+}
+
+// ListBlocked returns the users blocker has blocked, newest first.
+func (s *Service) ListBlocked(blocker string) ([]BlockedUser, error) {
+	out := []BlockedUser{}
+	err := s.st.DB.Select(&out, `SELECT blocked_id, created_at FROM user_blocks WHERE blocker_id=$1 ORDER BY created_at DESC`, blocker)
+	return out, err
+}
@@ -0,0 +1,26 @@
+package contacts
+
+import "testing"
+
+func TestBlockedBetween(t *testing.T) {
+	want := `EXISTS(SELECT 1 FROM user_blocks WHERE (blocker_id=$1 AND blocked_id=p.user_id) OR (blocker_id=p.user_id AND blocked_id=$1))`
+	if got := BlockedBetween("$1", "p.user_id"); got != want { t.Errorf("got %s", got) }
+}
+
+// These are refused before the database is touched.
+func TestBlockRejects(t *testing.T) {
+	s := &Service{}
+	const me = "3f2a9c1d-0000-4000-8000-000000000001"
+	cases := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"block self", s.Block(me, me), ErrBlockSelf},
+		{"block malformed id", s.Block(me, "not-a-uuid"), ErrUserNotFound},
+		{"unblock malformed id", s.Unblock(me, "1; DROP"), ErrNotBlocked},
+	}
+	for _, c := range cases {
+		if c.err != c.want { t.Errorf("%s: got %v want %v", c.name, c.err, c.want) }
+	}
+}
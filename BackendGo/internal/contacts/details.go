@@ -0,0 +1,127 @@
+package contacts
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"unicode/utf8"
+
+	"go-chat-backend/internal/models"
+	"go-chat-backend/internal/store"
+	"go-chat-backend/internal/users"
+)
+
+const (
+	maxNickname = 64
+	maxLabels   = 20
+	maxLabelLen = 32
+)
+
+var (
+	ErrContactNotFound = errors.New("contact not found")
+	ErrInvalidContact  = errors.New("nickname must be at most 64 characters; at most 20 labels of up to 32 characters")
+)
+
+// Entry is a contact as listed to its owner.
+type Entry struct {
+	models.Contact
+	Email       string `db:"email" json:"email"`
+	DisplayName string `db:"display_name" json:"display_name"`
+
+	// Deprecated: the list used to return only these two fields; they stay
+	// until clients have moved to contact_id and email.
+	LegacyContactID string `db:"-" json:"ContactID"`
+	LegacyEmail     string `db:"-" json:"Email"`
+}
+
+// ListFilter narrows List; zero values match everything.
+type ListFilter struct {
+	Label         string
+	FavoritesOnly bool
+}
+
+// List returns ownerID's contacts, favorites first, then by nickname or name.
+// Labels match case-insensitively; lists are small enough that scanning the
+// owner's rows beats an index on labels.
+func (s *Service) List(ownerID string, f ListFilter) ([]Entry, error) {
+	q := `SELECT c.id, c.owner_id, c.contact_id, c.nickname, c.favorite, c.created_at, array_to_json(c.labels)::text AS labels_json,
+			u.email, COALESCE(u.display_name,'') AS display_name
+		FROM contacts c JOIN users u ON u.id=c.contact_id WHERE c.owner_id=$1`
+	args := []any{ownerID}
+	if f.Label != "" { args = append(args, strings.ToLower(strings.TrimSpace(f.Label))); q += ` AND EXISTS(SELECT 1 FROM unnest(c.labels) l WHERE lower(l)=$2)` }
+	if f.FavoritesOnly { q += ` AND c.favorite` }
+	q += ` ORDER BY c.favorite DESC, lower(COALESCE(c.nickname, u.display_name, u.email))`
+	rows, err := s.st.DB.Queryx(q, args...)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	out := []Entry{}
+	for rows.Next() {
+		var row struct {
+			Entry
+			LabelsJSON string `db:"labels_json"`
+		}
+		if err := rows.StructScan(&row); err != nil { return nil, err }
+		if err := json.Unmarshal([]byte(row.LabelsJSON), &row.Labels); err != nil { return nil, err }
+		row.DisplayName = users.DisplayName(row.DisplayName, row.ContactID, false)
+		row.LegacyContactID, row.LegacyEmail = row.ContactID, row.Email
+		out = append(out, row.Entry)
+	}
+	return out, rows.Err()
+}
+
+// ContactUpdate is a partial update of the owner's side of a contact.
+type ContactUpdate struct {
+	Nickname *string   `json:"nickname"` // "" clears
+	Labels   *[]string `json:"labels"`   // replaces the whole set
+	Favorite *bool     `json:"favorite"`
+}
+
+// normalizeLabels trims labels and drops empties and case-insensitive duplicates.
+func normalizeLabels(in []string) ([]string, error) {
+	out := []string{}
+	seen := map[string]bool{}
+	for _, l := range in {
+		l = strings.TrimSpace(l)
+		if l == "" || seen[strings.ToLower(l)] { continue }
+		if utf8.RuneCountInString(l) > maxLabelLen { return nil, ErrInvalidContact }
+		seen[strings.ToLower(l)] = true
+		out = append(out, l)
+	}
+	if len(out) > maxLabels { return nil, ErrInvalidContact }
+	return out, nil
+}
+
+// Update changes ownerID's nickname, labels or favorite flag for contactID.
+func (s *Service) Update(ownerID, contactID string, u ContactUpdate) error {
+	if !store.IsUUID(contactID) { return ErrContactNotFound }
+	var nick *string
+	if u.Nickname != nil {
+		v := strings.TrimSpace(*u.Nickname)
+		if utf8.RuneCountInString(v) > maxNickname { return ErrInvalidContact }
+		nick = &v
+	}
+	var labels []string
+	if u.Labels != nil {
+		var err error
+		if labels, err = normalizeLabels(*u.Labels); err != nil { return err }
+	}
+	res, err := s.st.DB.Exec(`UPDATE contacts SET
+		nickname = CASE WHEN $3::text IS NULL THEN nickname ELSE NULLIF($3,'') END,
+		labels   = CASE WHEN $4 THEN $5::text[] ELSE labels END,
+		favorite = COALESCE($6, favorite)
+		WHERE owner_id=$1 AND contact_id=$2`, ownerID, contactID, nick, u.Labels != nil, labels, u.Favorite)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return ErrContactNotFound }
+	return nil
+}
+
+// Remove ends the contact relationship on both sides; the other user is
+// told so their list stays in sync. Existing conversations are kept.
+func (s *Service) Remove(ownerID, contactID string) error {
+	if !store.IsUUID(contactID) { return ErrContactNotFound }
+	res, err := s.st.DB.Exec(`DELETE FROM contacts WHERE (owner_id=$1 AND contact_id=$2) OR (owner_id=$2 AND contact_id=$1)`, ownerID, contactID)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n == 0 { return ErrContactNotFound }
+	if s.notifier != nil { s.notifier.SendToUser(contactID, map[string]any{"type": "contact_removed", "user_id": ownerID}) }
+	return nil
+}
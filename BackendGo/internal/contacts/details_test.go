@@ -0,0 +1,32 @@
+package contacts
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-chat-backend/internal/models"
+)
+
+// Clients written against the old list read ContactID and Email.
+func TestEntryKeepsLegacyFields(t *testing.T) {
+	e := Entry{Contact: models.Contact{ContactID: "u2"}, Email: "bob@example.com", LegacyContactID: "u2", LegacyEmail: "bob@example.com"}
+	b, err := json.Marshal(e)
+	if err != nil { t.Fatal(err) }
+	var got map[string]any
+	if err := json.Unmarshal(b, &got); err != nil { t.Fatal(err) }
+	for k, want := range map[string]string{"ContactID": "u2", "Email": "bob@example.com", "contact_id": "u2", "email": "bob@example.com"} {
+		if got[k] != want { t.Errorf("%s = %v, want %s", k, got[k], want) }
+	}
+}
+
+func TestNormalizeLabels(t *testing.T) {
+	got, err := normalizeLabels([]string{" Work ", "work", "", "Family", "  "})
+	if err != nil || !reflect.DeepEqual(got, []string{"Work", "Family"}) { t.Errorf("got %v, %v", got, err) }
+	if got, err := normalizeLabels(nil); err != nil || got == nil || len(got) != 0 { t.Errorf("nil input: %v, %v", got, err) }
+	if _, err := normalizeLabels([]string{strings.Repeat("x", 33)}); err != ErrInvalidContact { t.Errorf("long label: %v", err) }
+	many := make([]string, 21)
+	for i := range many { many[i] = strings.Repeat("a", i+1) }
+	if _, err := normalizeLabels(many); err != ErrInvalidContact { t.Errorf("too many labels: %v", err) }
+}
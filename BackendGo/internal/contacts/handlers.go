@@ -1,8 +1,12 @@
 package contacts
 
 import (
+	"bufio"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strconv"
+	"strings"
 
 	"go-chat-backend/internal/auth"
 )
@@ -15,15 +19,136 @@ func HandleAdd(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
 	idOrEmail := req.ContactID
 	if idOrEmail == "" { idOrEmail = req.ContactEmail }
-	_, err := s.Add(u.UserID, idOrEmail)
+	cr, err := s.Add(u.UserID, idOrEmail)
+	if errors.Is(err, ErrAlreadyContacts) { return json.NewEncoder(w).Encode(map[string]string{"status": "already_contacts"}) }
+	if errors.Is(err, ErrAddSelf) { http.Error(w, err.Error(), http.StatusBadRequest); return nil }
+	if errors.Is(err, ErrUserNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if errors.Is(err, ErrUnverified) { http.Error(w, err.Error(), http.StatusForbidden); return nil }
+	if errors.Is(err, ErrBlocked) { http.Error(w, err.Error(), http.StatusConflict); return nil }
+	if errors.Is(err, ErrNotAccepting) { http.Error(w, err.Error(), http.StatusForbidden); return nil }
 	if err != nil { return err }
-	w.WriteHeader(http.StatusCreated)
-	return json.NewEncoder(w).Encode(map[string]string{"status":"ok"})
+	// 201 when they had already asked us and are now a contact, 202 while our request is pending.
+	if cr.Status == RequestAccepted { w.WriteHeader(http.StatusCreated) } else { w.WriteHeader(http.StatusAccepted) }
+	return json.NewEncoder(w).Encode(map[string]any{"status": cr.Status, "request": cr})
 }
 
 func HandleList(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
 	u := r.Context().Value("user").(*auth.Claims)
-	items, err := s.List(u.UserID)
+	q := r.URL.Query()
+	items, err := s.List(u.UserID, ListFilter{Label: q.Get("label"), FavoritesOnly: q.Get("favorites") == "true"})
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(items)
+}
+
+// HandleContact serves PATCH and DELETE /api/contacts/{user_id}.
+func HandleContact(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	var err error
+	switch r.Method {
+	case http.MethodPatch:
+		var req ContactUpdate
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+		err = s.Update(u.UserID, id, req)
+	case http.MethodDelete:
+		err = s.Remove(u.UserID, id)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed); return nil
+	}
+	if errors.Is(err, ErrContactNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if errors.Is(err, ErrInvalidContact) { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+type blockReq struct{ UserID string `json:"user_id"` }
+
+// HandleListBlocks serves GET /api/blocks.
+func HandleListBlocks(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	items, err := s.ListBlocked(u.UserID)
 	if err != nil { return err }
 	return json.NewEncoder(w).Encode(items)
-}
\ No newline at end of file
+}
+
+// HandleBlock serves POST /api/blocks.
+func HandleBlock(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	var req blockReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	err := s.Block(u.UserID, req.UserID)
+	if errors.Is(err, ErrUserNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if errors.Is(err, ErrBlockSelf) { http.Error(w, err.Error(), http.StatusBadRequest); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(map[string]string{"status":"blocked"})
+}
+
+// HandleUnblock serves DELETE /api/blocks/{user_id}.
+func HandleUnblock(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	err := s.Unblock(u.UserID, r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:])
+	if errors.Is(err, ErrNotBlocked) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if err != nil { return err }
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+// HandleListRequests serves GET /api/contacts/requests?direction=incoming|outgoing.
+func HandleListRequests(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	items, err := s.ListRequests(u.UserID, r.URL.Query().Get("direction") != "outgoing")
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(items)
+}
+
+// HandleRequestAction serves POST /api/contacts/requests/{id}/accept and
+// /decline for the recipient, and DELETE /api/contacts/requests/{id} to
+// cancel for the requester.
+func HandleRequestAction(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/contacts/requests/"), "/"), "/")
+	id, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil { http.NotFound(w, r); return nil }
+	var req *Request
+	switch {
+	case r.Method == http.MethodDelete && len(parts) == 1: req, err = s.Cancel(u.UserID, id)
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "accept": req, err = s.Accept(u.UserID, id)
+	case r.Method == http.MethodPost && len(parts) == 2 && parts[1] == "decline": req, err = s.Decline(u.UserID, id)
+	default: w.WriteHeader(http.StatusMethodNotAllowed); return nil
+	}
+	if errors.Is(err, ErrRequestNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(req)
+}
+
+// maxImportBytes bounds an uploaded address book.
+const maxImportBytes = 2 << 20
+
+// HandleImport serves POST /api/contacts/import?format=vcard|csv&invite=true.
+// The body is the raw file; without format, it is sniffed from the content.
+func HandleImport(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	body := bufio.NewReader(http.MaxBytesReader(w, r.Body, maxImportBytes))
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		head, _ := body.Peek(64)
+		format = "csv"
+		if strings.HasPrefix(strings.ToUpper(strings.TrimSpace(strings.TrimPrefix(string(head), "\ufeff"))), "BEGIN:VCARD") { format = "vcard" }
+	}
+	var (
+		rows []ImportRow
+		err  error
+	)
+	switch format {
+	case "vcard": rows, err = ParseVCards(body)
+	case "csv": rows, err = ParseCSV(body)
+	default: http.Error(w, "format must be vcard or csv", http.StatusBadRequest); return nil
+	}
+	var tooBig *http.MaxBytesError
+	if errors.As(err, &tooBig) { http.Error(w, "file too large", http.StatusRequestEntityTooLarge); return nil }
+	if err != nil { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return nil }
+	report, err := s.Import(u.UserID, rows, r.URL.Query().Get("invite") == "true")
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,237 @@
+package contacts
+
+import (
+	"bufio"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"strings"
+
+	"go-chat-backend/internal/auth"
+	"go-chat-backend/internal/mail"
+)
+
+const (
+	maxImportRows     = 1000
+	maxInvitesPerDay  = 50
+	inviteResendAfter = "30 days" // interval before the same address can be invited again
+)
+
+// Per-row import outcomes.
+const (
+	ImportAdded          = "added"           // request sent, or accepted if they had asked first
+	ImportAlreadyPresent = "already_present" // already a contact or a request is pending
+	ImportNotFound       = "not_found"
+	ImportInvalid        = "invalid"
+)
+
+var ErrTooManyRows = fmt.Errorf("imports are limited to %d entries", maxImportRows)
+
+// ImportRow is one entry from an uploaded address book.
+type ImportRow struct {
+	Line   int      // first line of the entry in the upload
+	Name   string
+	Emails []string // first one that belongs to a user wins
+	Err    string   // parse problem, reported as invalid
+}
+
+// ImportReport is what the uploader learns: totals per outcome and the
+// entries that could not be read. Outcomes are not given per address, or a
+// large upload would tell which addresses have accounts.
+type ImportReport struct {
+	Summary    map[string]int  `json:"summary"`
+	Unreadable []ImportProblem `json:"unreadable"`
+}
+
+// ImportProblem is an entry without a usable email address.
+type ImportProblem struct {
+	Line   int    `json:"line"`
+	Name   string `json:"name,omitempty"`
+	Reason string `json:"reason"`
+}
+
+type importResult struct {
+	Email, Status, Reason string
+}
+
+// ParseVCards reads vCard 3.0/4.0 entries, taking FN and every EMAIL.
+func ParseVCards(r io.Reader) ([]ImportRow, error) {
+	lines, err := unfold(r)
+	if err != nil { return nil, err }
+	var (
+		out []ImportRow
+		cur *ImportRow
+		ver string
+	)
+	for i, l := range lines {
+		name, value, ok := strings.Cut(l.text, ":")
+		if !ok { continue }
+		prop := strings.ToUpper(name)
+		if j := strings.IndexByte(prop, ';'); j >= 0 { prop = prop[:j] }
+		if j := strings.LastIndexByte(prop, '.'); j >= 0 { prop = prop[j+1:] } // grouped: item1.EMAIL
+		switch {
+		case prop == "BEGIN" && strings.EqualFold(value, "VCARD"):
+			cur, ver = &ImportRow{Line: lines[i].no}, ""
+		case cur == nil:
+			continue
+		case prop == "VERSION":
+			ver = strings.TrimSpace(value)
+		case prop == "FN":
+			cur.Name = unescapeVCard(value)
+		case prop == "EMAIL":
+			if e := strings.TrimSpace(strings.TrimPrefix(value, "mailto:")); e != "" { cur.Emails = append(cur.Emails, e) }
+		case prop == "END" && strings.EqualFold(value, "VCARD"):
+			if ver != "3.0" && ver != "4.0" { cur.Err = "unsupported vCard version " + ver }
+			if len(cur.Emails) == 0 && cur.Err == "" { cur.Err = "no email address" }
+			out = append(out, *cur)
+			cur = nil
+			if len(out) > maxImportRows { return nil, ErrTooManyRows }
+		}
+	}
+	return out, nil
+}
+
+type line struct {
+	no   int
+	text string
+}
+
+// unfold joins RFC 6350 folded lines (continuations start with a space or tab).
+func unfold(r io.Reader) ([]line, error) {
+	sc := bufio.NewScanner(r)
+	var out []line
+	for n := 1; sc.Scan(); n++ {
+		t := strings.TrimRight(sc.Text(), "\r")
+		if (strings.HasPrefix(t, " ") || strings.HasPrefix(t, "\t")) && len(out) > 0 {
+			out[len(out)-1].text += t[1:]
+			continue
+		}
+		out = append(out, line{no: n, text: t})
+	}
+	return out, sc.Err()
+}
+
+func unescapeVCard(s string) string {
+	return strings.NewReplacer(`\,`, ",", `\;`, ";", `\n`, " ", `\N`, " ", `\\`, `\`).Replace(strings.TrimSpace(s))
+}
+
+// ParseCSV reads a CSV export with a header row naming an email column
+// ("email", "e-mail", "email address", ...) and optionally a name column.
+func ParseCSV(r io.Reader) ([]ImportRow, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	header, err := cr.Read()
+	if errors.Is(err, io.EOF) { return nil, nil }
+	if err != nil { return nil, err }
+	emailCol, nameCol := -1, -1
+	for i, h := range header {
+		h = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(h, "\ufeff")))
+		switch {
+		case emailCol < 0 && (h == "email" || h == "e-mail" || strings.HasPrefix(h, "email ") || strings.HasPrefix(h, "e-mail ")):
+			emailCol = i
+		case nameCol < 0 && (h == "name" || h == "full name" || h == "display name"):
+			nameCol = i
+		}
+	}
+	if emailCol < 0 { return nil, errors.New("CSV needs a header row with an email column") }
+	var out []ImportRow
+	for {
+		rec, err := cr.Read()
+		if errors.Is(err, io.EOF) { break }
+		var row ImportRow
+		var pe *csv.ParseError
+		if errors.As(err, &pe) {
+			row.Line, row.Err = pe.StartLine, "malformed CSV row"
+		} else if err != nil {
+			return nil, err
+		} else {
+			row.Line, _ = cr.FieldPos(0)
+			if nameCol >= 0 && nameCol < len(rec) { row.Name = strings.TrimSpace(rec[nameCol]) }
+			if emailCol < len(rec) && strings.TrimSpace(rec[emailCol]) != "" { row.Emails = []string{strings.TrimSpace(rec[emailCol])} } else { row.Err = "no email address" }
+		}
+		out = append(out, row)
+		if len(out) > maxImportRows { return nil, ErrTooManyRows }
+	}
+	return out, nil
+}
+
+// Import sends contact requests for every row that matches a user. With
+// invite set, addresses without an account get an invitation mail, at most
+// once per address per 30 days and maxInvitesPerDay per user. Invitations go
+// out in the background and are not counted, so the report never tells an
+// address without an account from one that is hidden.
+func (s *Service) Import(ownerID string, rows []ImportRow, invite bool) (*ImportReport, error) {
+	rep := &ImportReport{Summary: map[string]int{}, Unreadable: []ImportProblem{}}
+	var unmatched []string
+	for _, row := range rows {
+		res := importResult{Status: ImportInvalid, Reason: row.Err}
+		if row.Err == "" {
+			matched, err := s.importRow(ownerID, row, &res)
+			if err != nil { return nil, err }
+			if !matched && res.Status == ImportNotFound { unmatched = append(unmatched, res.Email) }
+		}
+		rep.Summary[res.Status]++
+		// Only problems with the entry itself; refusals would name the account.
+		if res.Email == "" { rep.Unreadable = append(rep.Unreadable, ImportProblem{Line: row.Line, Name: row.Name, Reason: res.Reason}) }
+	}
+	if invite && len(unmatched) > 0 { go s.invite(ownerID, unmatched) }
+	return rep, nil
+}
+
+// importRow tries the row's addresses in order and fills in res; matched is
+// false when none of them belongs to a user.
+func (s *Service) importRow(ownerID string, row ImportRow, res *importResult) (matched bool, err error) {
+	res.Status, res.Reason = ImportInvalid, "invalid email address"
+	for _, raw := range row.Emails {
+		email, err := auth.NormalizeEmail(raw)
+		if err != nil { continue }
+		if res.Status == ImportInvalid { res.Email, res.Status, res.Reason = email, ImportNotFound, "" }
+		_, created, err := s.add(ownerID, email)
+		switch {
+		case errors.Is(err, ErrUserNotFound), errors.Is(err, ErrUnverified):
+			continue // maybe another of their addresses
+		case errors.Is(err, ErrAlreadyContacts):
+			res.Email, res.Status = email, ImportAlreadyPresent
+		case errors.Is(err, ErrAddSelf), errors.Is(err, ErrBlocked), errors.Is(err, ErrNotAccepting):
+			res.Email, res.Status, res.Reason = email, ImportInvalid, err.Error()
+		case err != nil:
+			return false, err
+		case created:
+			res.Email, res.Status = email, ImportAdded
+		default:
+			res.Email, res.Status = email, ImportAlreadyPresent
+		}
+		return true, nil
+	}
+	return false, nil
+}
+
+// invite mails the addresses that have no account at all. The text is fixed:
+// nothing the inviter chose goes into mail to addresses they typed in.
+func (s *Service) invite(ownerID string, emails []string) {
+	if s.mailer == nil { return }
+	var sentToday int
+	if err := s.st.DB.QueryRowx(`SELECT count(*) FROM contact_invites WHERE inviter_id=$1 AND sent_at > now() - interval '24 hours'`, ownerID).
+		Scan(&sentToday); err != nil {
+		log.Printf("contact invites: %v", err); return
+	}
+	for _, email := range emails {
+		if sentToday >= maxInvitesPerDay { return }
+		// Only brand-new addresses: the row claims the slot atomically, and
+		// existing (e.g. unverified) accounts are never mailed from here.
+		res, err := s.st.DB.Exec(`INSERT INTO contact_invites(inviter_id, email) SELECT $1, $2
+			WHERE NOT EXISTS(SELECT 1 FROM users WHERE email=$2)
+			ON CONFLICT (inviter_id, email) DO UPDATE SET sent_at=now() WHERE contact_invites.sent_at < now() - interval '`+inviteResendAfter+`'`, ownerID, email)
+		if err != nil { log.Printf("contact invite %s: %v", email, err); continue }
+		if n, _ := res.RowsAffected(); n == 0 { continue }
+		msg := mail.Message{To: email, Subject: "You have been invited to Go Chat", Body: fmt.Sprintf(
+			"Someone who has your email address would like to chat with you on Go Chat.\n\nCreate your account here:\n%s/register?email=%s\n\nIf you do not want to join, ignore this message.\n",
+			s.appURL, url.QueryEscape(email))}
+		if err := s.mailer.Send(msg); err != nil { log.Printf("contact invite mail: %v", err) }
+		sentToday++
+	}
+}
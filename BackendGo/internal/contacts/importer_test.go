@@ -0,0 +1,55 @@
+package contacts
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseVCards(t *testing.T) {
+	in := "BEGIN:VCARD\r\nVERSION:4.0\r\nFN:Ann\\, Lee\r\nEMAIL;TYPE=work:ann@example.com\r\nitem1.EMAIL:ann.lee@\r\n example.org\r\nEND:VCARD\r\n" +
+		"BEGIN:VCARD\nVERSION:3.0\nFN:No Mail\nEND:VCARD\n" +
+		"BEGIN:VCARD\nVERSION:2.1\nEMAIL:old@example.com\nEND:VCARD\n"
+	rows, err := ParseVCards(strings.NewReader(in))
+	if err != nil { t.Fatal(err) }
+	if len(rows) != 3 { t.Fatalf("got %d rows", len(rows)) }
+	if rows[0].Name != "Ann, Lee" || !reflect.DeepEqual(rows[0].Emails, []string{"ann@example.com", "ann.lee@example.org"}) || rows[0].Err != "" {
+		t.Errorf("row 0 = %+v", rows[0])
+	}
+	if rows[1].Line != 8 || rows[1].Err != "no email address" { t.Errorf("row 1 = %+v", rows[1]) }
+	if !strings.Contains(rows[2].Err, "version") { t.Errorf("row 2 = %+v", rows[2]) }
+}
+
+func TestParseCSV(t *testing.T) {
+	in := "\ufeffName,E-mail Address,Phone\nAnn Lee,ann@example.com,123\nBob,,456\n\"Eve\",eve@example.com\n"
+	rows, err := ParseCSV(strings.NewReader(in))
+	if err != nil { t.Fatal(err) }
+	want := []ImportRow{
+		{Line: 2, Name: "Ann Lee", Emails: []string{"ann@example.com"}},
+		{Line: 3, Name: "Bob", Err: "no email address"},
+		{Line: 4, Name: "Eve", Emails: []string{"eve@example.com"}},
+	}
+	if !reflect.DeepEqual(rows, want) { t.Errorf("got %+v", rows) }
+	if _, err := ParseCSV(strings.NewReader("name,phone\nAnn,1\n")); err == nil { t.Error("CSV without email column accepted") }
+}
+
+func TestParseCSVMalformedRow(t *testing.T) {
+	rows, err := ParseCSV(strings.NewReader("email\nx\"y@a.com\nok@a.com\n"))
+	if err != nil { t.Fatal(err) }
+	want := []ImportRow{
+		{Line: 2, Err: "malformed CSV row"},
+		{Line: 3, Emails: []string{"ok@a.com"}},
+	}
+	if !reflect.DeepEqual(rows, want) { t.Errorf("got %+v", rows) }
+}
+
+
+// Entries without a usable address never reach the database.
+func TestImportUnreadable(t *testing.T) {
+	rows := []ImportRow{{Line: 2, Name: "Bob", Err: "no email address"}, {Line: 3, Name: "Eve", Emails: []string{"not an address"}}}
+	rep, err := (&Service{}).Import("u1", rows, false)
+	if err != nil { t.Fatal(err) }
+	if !reflect.DeepEqual(rep.Summary, map[string]int{ImportInvalid: 2}) { t.Errorf("summary = %v", rep.Summary) }
+	want := []ImportProblem{{Line: 2, Name: "Bob", Reason: "no email address"}, {Line: 3, Name: "Eve", Reason: "invalid email address"}}
+	if !reflect.DeepEqual(rep.Unreadable, want) { t.Errorf("unreadable = %+v", rep.Unreadable) }
+}
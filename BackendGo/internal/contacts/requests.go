@@ -0,0 +1,197 @@
+package contacts
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"go-chat-backend/internal/users"
+)
+
+// Contact request states.
+const (
+	RequestPending   = "pending"
+	RequestAccepted  = "accepted"
+	RequestDeclined  = "declined"
+	RequestCancelled = "cancelled"
+)
+
+// declineCooldown is how long after a decline the same person may not ask
+// again.
+const declineCooldown = 30 * 24 * time.Hour
+
+var (
+	ErrAlreadyContacts = errors.New("already contacts")
+	ErrRequestNotFound = errors.New("contact request not found")
+)
+
+// Notifier pushes events to a user's live connections; *ws.Hub implements it.
+type Notifier interface{ SendToUser(userID string, payload any) }
+
+type Request struct {
+	ID            int64      `db:"id" json:"id"`
+	RequesterID   string     `db:"requester_id" json:"requester_id"`
+	RequesterName string     `db:"-" json:"requester_name"`
+	RecipientID   string     `db:"recipient_id" json:"recipient_id"`
+	RecipientName string     `db:"-" json:"recipient_name"`
+	Status        string     `db:"status" json:"status"`
+	CreatedAt     time.Time  `db:"created_at" json:"created_at"`
+	RespondedAt   *time.Time `db:"responded_at" json:"responded_at"`
+}
+
+const requestCols = `r.id, r.requester_id, r.recipient_id, r.status, r.created_at, r.responded_at,
+	COALESCE(a.display_name,'') AS a_name, COALESCE(b.display_name,'') AS b_name`
+
+const requestFrom = `FROM contact_requests r JOIN users a ON a.id=r.requester_id JOIN users b ON b.id=r.recipient_id`
+
+type requestRow struct {
+	Request
+	AName string `db:"a_name"`
+	BName string `db:"b_name"`
+}
+
+func (r *requestRow) request() *Request {
+	q := r.Request
+	q.RequesterName = users.DisplayName(r.AName, r.RequesterID, false)
+	q.RecipientName = users.DisplayName(r.BName, r.RecipientID, false)
+	return &q
+}
+
+type queryer interface {
+	QueryRowx(query string, args ...any) *sqlx.Row
+}
+
+func getRequest(db queryer, where string, args ...any) (*Request, error) {
+	var row requestRow
+	err := db.QueryRowx(`SELECT `+requestCols+` `+requestFrom+` WHERE `+where, args...).StructScan(&row)
+	if errors.Is(err, sql.ErrNoRows) { return nil, ErrRequestNotFound }
+	if err != nil { return nil, err }
+	return row.request(), nil
+}
+
+// requestFacts is what decides the fate of a new request from owner to
+// recipient.
+type requestFacts struct {
+	Mutual     bool       // already contacts
+	Reverse    bool       // recipient has a pending request to owner
+	DeclinedAt *time.Time // when recipient last declined owner, if ever
+	Allowed    bool       // recipient's privacy settings let owner ask
+}
+
+// decide returns RequestAccepted when the request completes a crossing one,
+// RequestPending when it should be sent, or why it is refused. A recent
+// decline is refused like the privacy settings would, so the requester
+// cannot tell it was declined.
+func (f requestFacts) decide(now time.Time) (string, error) {
+	switch {
+	case f.Mutual: return "", ErrAlreadyContacts
+	case f.Reverse: return RequestAccepted, nil
+	case f.DeclinedAt != nil && now.Sub(*f.DeclinedAt) < declineCooldown, !f.Allowed: return "", ErrNotAccepting
+	}
+	return RequestPending, nil
+}
+
+// request asks recipient to become ownerID's contact, or accepts recipient's
+// pending request to ownerID; see requestFacts.decide. created is false when
+// an identical request was already pending. Both users' rows are locked so
+// two people adding each other at once end up as contacts, not with two
+// crossing requests.
+func (s *Service) request(ownerID, recipient string) (req *Request, created bool, err error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, false, err }
+	defer tx.Rollback()
+	if _, err := tx.Exec(`SELECT 1 FROM users WHERE id IN ($1,$2) ORDER BY id FOR NO KEY UPDATE`, ownerID, recipient); err != nil { return nil, false, err }
+	var f requestFacts
+	if err := tx.QueryRowx(`SELECT `+MutualSQL+`, (SELECT max(responded_at) FROM contact_requests WHERE requester_id=$1 AND recipient_id=$2 AND status='declined')`,
+		ownerID, recipient).Scan(&f.Mutual, &f.DeclinedAt); err != nil { return nil, false, err }
+	rev, err := getRequest(tx, `r.requester_id=$1 AND r.recipient_id=$2 AND r.status='pending' FOR UPDATE OF r`, recipient, ownerID)
+	if err != nil && !errors.Is(err, ErrRequestNotFound) { return nil, false, err }
+	f.Reverse = err == nil
+	if f.Allowed, err = s.privacy.CanRequest(ownerID, recipient); err != nil { return nil, false, err }
+	next, err := f.decide(time.Now())
+	if err != nil { return nil, false, err }
+	if next == RequestAccepted {
+		if err := accept(tx, rev); err != nil { return nil, false, err }
+		if err := tx.Commit(); err != nil { return nil, false, err }
+		s.notify(rev.RequesterID, "contact_request_accepted", rev)
+		return rev, true, nil
+	}
+
+	var id int64
+	err = tx.QueryRowx(`INSERT INTO contact_requests(requester_id, recipient_id) VALUES($1,$2)
+		ON CONFLICT (requester_id, recipient_id) WHERE status='pending' DO NOTHING RETURNING id`, ownerID, recipient).Scan(&id)
+	created = err == nil
+	if err != nil && !errors.Is(err, sql.ErrNoRows) { return nil, false, err }
+	req, err = getRequest(tx, `r.requester_id=$1 AND r.recipient_id=$2 AND r.status='pending'`, ownerID, recipient)
+	if err != nil { return nil, false, err }
+	if err := tx.Commit(); err != nil { return nil, false, err }
+	if created { s.notify(recipient, "contact_request", req) }
+	return req, created, nil
+}
+
+// Accept turns a pending request addressed to recipient into contacts on both sides.
+func (s *Service) Accept(recipient string, id int64) (*Request, error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	req, err := getRequest(tx, `r.id=$1 AND r.recipient_id=$2 AND r.status='pending' FOR UPDATE OF r`, id, recipient)
+	if err != nil { return nil, err }
+	if err := accept(tx, req); err != nil { return nil, err }
+	if err := tx.Commit(); err != nil { return nil, err }
+	s.notify(req.RequesterID, "contact_request_accepted", req)
+	return req, nil
+}
+
+// accept marks the locked pending req accepted and adds both contact rows.
+func accept(tx *sqlx.Tx, req *Request) error {
+	if err := tx.QueryRowx(`UPDATE contact_requests SET status='accepted', responded_at=now() WHERE id=$1 RETURNING status, responded_at`, req.ID).
+		Scan(&req.Status, &req.RespondedAt); err != nil { return err }
+	_, err := tx.Exec(`INSERT INTO contacts(owner_id, contact_id) VALUES($1,$2),($2,$1) ON CONFLICT(owner_id, contact_id) DO NOTHING`,
+		req.RequesterID, req.RecipientID)
+	return err
+}
+
+// Decline rejects a pending request addressed to recipient. The requester
+// is not told; the request just stops being pending.
+func (s *Service) Decline(recipient string, id int64) (*Request, error) {
+	return s.close(`recipient_id`, recipient, id, RequestDeclined, nil)
+}
+
+// Cancel withdraws a pending request requester sent.
+func (s *Service) Cancel(requester string, id int64) (*Request, error) {
+	return s.close(`requester_id`, requester, id, RequestCancelled, func(r *Request) string { return r.RecipientID })
+}
+
+// close moves userID's pending request id to status and notifies
+// notifyWho(req) if notifyWho is not nil.
+func (s *Service) close(col, userID string, id int64, status string, notifyWho func(*Request) string) (*Request, error) {
+	res, err := s.st.DB.Exec(`UPDATE contact_requests SET status=$3, responded_at=now() WHERE id=$1 AND `+col+`=$2 AND status='pending'`, id, userID, status)
+	if err != nil { return nil, err }
+	if n, _ := res.RowsAffected(); n == 0 { return nil, ErrRequestNotFound }
+	req, err := getRequest(s.st.DB, `r.id=$1`, id)
+	if err != nil { return nil, err }
+	if notifyWho != nil { s.notify(notifyWho(req), "contact_request_"+status, req) }
+	return req, nil
+}
+
+// ListRequests returns userID's pending requests; incoming selects those
+// addressed to them, otherwise the ones they sent.
+func (s *Service) ListRequests(userID string, incoming bool) ([]*Request, error) {
+	col := "r.requester_id"
+	if incoming { col = "r.recipient_id" }
+	rows, err := s.st.DB.Queryx(`SELECT `+requestCols+` `+requestFrom+` WHERE `+col+`=$1 AND r.status='pending' ORDER BY r.created_at DESC`, userID)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	out := []*Request{}
+	for rows.Next() {
+		var row requestRow
+		if err := rows.StructScan(&row); err != nil { return nil, err }
+		out = append(out, row.request())
+	}
+	return out, rows.Err()
+}
+
+func (s *Service) notify(userID, typ string, req *Request) {
+	if s.notifier != nil { s.notifier.SendToUser(userID, map[string]any{"type": typ, "request": req}) }
+}
@@ -0,0 +1,30 @@
+package contacts
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRequestDecide(t *testing.T) {
+	now := time.Now()
+	recent, old := now.Add(-24*time.Hour), now.Add(-declineCooldown-time.Hour)
+	cases := []struct {
+		name string
+		f    requestFacts
+		want string
+		err  error
+	}{
+		{"new request", requestFacts{Allowed: true}, RequestPending, nil},
+		{"privacy refuses", requestFacts{}, "", ErrNotAccepting},
+		{"already contacts", requestFacts{Mutual: true, Reverse: true, Allowed: true}, "", ErrAlreadyContacts},
+		{"crossing request is accepted", requestFacts{Reverse: true, Allowed: true}, RequestAccepted, nil},
+		// They asked, so their own settings and old declines do not matter.
+		{"crossing request overrides privacy", requestFacts{Reverse: true, DeclinedAt: &recent}, RequestAccepted, nil},
+		{"declined recently", requestFacts{DeclinedAt: &recent, Allowed: true}, "", ErrNotAccepting},
+		{"declined long ago", requestFacts{DeclinedAt: &old, Allowed: true}, RequestPending, nil},
+	}
+	for _, c := range cases {
+		got, err := c.f.decide(now)
+		if got != c.want || err != c.err { t.Errorf("%s: got %q, %v want %q, %v", c.name, got, err, c.want, c.err) }
+	}
+}
@@ -4,47 +4,74 @@ import (
 	"database/sql"
 	"errors"
 	"strings"
-	"time"
 
+	"go-chat-backend/internal/mail"
+	"go-chat-backend/internal/privacy"
 	"go-chat-backend/internal/store"
 )
 
-type Service struct{ st *store.Store }
-func NewService(st *store.Store) *Service { return &Service{st: st} }
+type Service struct {
+	st       *store.Store
+	notifier Notifier    // may be nil
+	mailer   mail.Sender // for import invitations; may be nil
+	appURL   string      // base URL of the web client, used in invitations
+	privacy  *privacy.Service // decides who may send contact requests
+}
+
+func NewService(st *store.Store, privacy *privacy.Service, notifier Notifier, mailer mail.Sender, appURL string) *Service {
+	return &Service{st: st, privacy: privacy, notifier: notifier, mailer: mailer, appURL: appURL}
+}
+
+var (
+	ErrUserNotFound = errors.New("user not found")
+	ErrUnverified   = errors.New("user has not verified their email yet")
+	ErrAddSelf      = errors.New("you cannot add yourself")
+	ErrNotAccepting = errors.New("this user does not accept contact requests from you")
+)
 
 type AddInput struct{ OwnerID, ContactID, ContactEmail string }
 
-func (s *Service) Add(ownerID, contactIDOrEmail string) (int64, error) {
+// Add sends a contact request to the user behind contactIDOrEmail, or
+// accepts theirs if they already asked. Contacts only exist in pairs.
+func (s *Service) Add(ownerID, contactIDOrEmail string) (*Request, error) {
+	req, _, err := s.add(ownerID, contactIDOrEmail)
+	return req, err
+}
+
+func (s *Service) add(ownerID, contactIDOrEmail string) (*Request, bool, error) {
 	// Resolve email -> user id if needed
-	cid := contactIDOrEmail
+	var (
+		cid      string
+		verified bool
+		err      error
+	)
 	if strings.Contains(contactIDOrEmail, "@") {
-		if err := s.st.DB.QueryRowx(`SELECT id FROM users WHERE email=$1`, strings.ToLower(contactIDOrEmail)).Scan(&cid); err != nil { return 0, err }
+		err = s.st.DB.QueryRowx(`SELECT id, email_verified_at IS NOT NULL FROM users WHERE email=$1 AND deleted_at IS NULL`, strings.ToLower(strings.TrimSpace(contactIDOrEmail))).Scan(&cid, &verified)
+	} else {
+		err = s.st.DB.QueryRowx(`SELECT id, email_verified_at IS NOT NULL FROM users WHERE id=$1::uuid AND deleted_at IS NULL`, contactIDOrEmail).Scan(&cid, &verified)
 	}
-	var id int64
-	err := s.st.DB.QueryRowx(`INSERT INTO contacts(owner_id, contact_id, created_at)
-		VALUES($1,$2,$3)
-		ON CONFLICT(owner_id, contact_id) DO UPDATE SET created_at=contacts.created_at
-		RETURNING id`, ownerID, cid, time.Now().UTC()).Scan(&id)
-	if err != nil { return 0, err }
-	return id, nil
+	if errors.Is(err, sql.ErrNoRows) { return nil, false, ErrUserNotFound }
+	if err != nil { return nil, false, err }
+	if cid == ownerID { return nil, false, ErrAddSelf }
+	// Unverified addresses could belong to anyone, so they cannot be added yet.
+	if !verified { return nil, false, ErrUnverified }
+	var iBlocked, theyBlocked bool
+	if err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id=$1 AND blocked_id=$2),
+		EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id=$2 AND blocked_id=$1)`, ownerID, cid).Scan(&iBlocked, &theyBlocked); err != nil { return nil, false, err }
+	if iBlocked { return nil, false, ErrBlocked }
+	// Do not reveal the block: to the blocked user the blocker does not exist.
+	if theyBlocked { return nil, false, ErrUserNotFound }
+	return s.request(ownerID, cid)
 }
 
-func (s *Service) List(ownerID string) ([]struct{ ContactID, Email string }, error) {
-	rows, err := s.st.DB.Queryx(`SELECT u.id as contact_id, u.email FROM contacts c JOIN users u ON u.id=c.contact_id WHERE c.owner_id=$1 ORDER BY u.email`, ownerID)
-	if err != nil { return nil, err }
-	defer rows.Close()
-	var out []struct{ ContactID, Email string }
-	for rows.Next() {
-		var a, b string
-		if err := rows.Scan(&a, &b); err != nil { return nil, err }
-		out = append(out, struct{ ContactID, Email string }{a, b})
-	}
-	return out, rows.Err()
-}
+// MutualSQL is true when $1 and $2 have each other as contacts.
+const MutualSQL = `EXISTS(SELECT 1 FROM contacts WHERE owner_id=$1 AND contact_id=$2) AND EXISTS(SELECT 1 FROM contacts WHERE owner_id=$2 AND contact_id=$1)`
 
+// AreMutual reports whether a and b have accepted each other as contacts.
+// A malformed id is nobody's contact.
 func (s *Service) AreMutual(a, b string) (bool, error) {
-	var x int
-	err := s.st.DB.QueryRowx(`SELECT 1 FROM contacts WHERE owner_id=$1 AND contact_id=$2`, a, b).Scan(&x)
-	if err != nil { if errors.Is(err, sql.ErrNoRows) { return false, nil } ; return false, err }
-	return true, nil
+	if !store.IsUUID(a) || !store.IsUUID(b) { return false, nil }
+	var ok bool
+	err := s.st.DB.QueryRowx(`SELECT `+MutualSQL, a, b).Scan(&ok)
+	return ok, err
 }
\ No newline at end of file
@@ -0,0 +1,312 @@
+package conversations
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jmoiron/sqlx"
+	"go-chat-backend/internal/users"
+)
+
+// Group member roles. Each group has exactly one owner.
+const (
+	MemberOwner  = "owner"
+	MemberAdmin  = "admin"
+	MemberMember = "member"
+)
+
+var memberRank = map[string]int{MemberMember: 0, MemberAdmin: 1, MemberOwner: 2}
+
+const (
+	maxGroupMembers = 256
+	maxGroupTitle   = 100
+)
+
+var (
+	ErrNotGroup          = errors.New("not a group conversation")
+	ErrNotMember         = errors.New("user is not a member of this group")
+	ErrInvalidTitle      = errors.New("title must be 1-100 characters")
+	ErrInvalidMemberRole = errors.New("role must be owner, admin or member")
+	ErrTooManyMembers    = errors.New("groups are limited to 256 members")
+	ErrOwnRole           = errors.New("the owner keeps their role until they make someone else the owner")
+)
+
+// Notifier delivers membership events; *ws.Hub implements it.
+type Notifier interface {
+	Broadcast(convID string, payload any)
+	SendToUser(userID string, payload any)
+	RemoveFromConversation(convID, userID string)
+}
+
+// Events carried by system messages.
+const (
+	EventGroupCreated  = "group_created"
+	EventMemberAdded   = "member_added"
+	EventMemberRemoved = "member_removed"
+	EventMemberLeft    = "member_left"
+	EventRoleChanged   = "role_changed"
+)
+
+// Meta is the machine-readable part of a system message.
+type Meta struct {
+	Event  string `json:"event"`
+	UserID string `json:"user_id,omitempty"` // the member the event is about
+	Role   string `json:"role,omitempty"`    // new role for role_changed
+}
+
+// Render is the text of a system message, from the current display names
+// of its sender and of the member it is about. Only meta is stored, so the
+// text follows renames and account deletion.
+func (m Meta) Render(senderID, sender, user string) string {
+	switch m.Event {
+	case EventGroupCreated: return sender + " created the group"
+	case EventMemberAdded: return sender + " added " + user
+	case EventMemberRemoved: return sender + " removed " + user
+	case EventMemberLeft: return sender + " left"
+	case EventRoleChanged:
+		role := map[string]string{MemberOwner: "the owner", MemberAdmin: "an admin"}[m.Role]
+		if role == "" { role = "a member" }
+		if m.UserID == senderID { return user + " is now " + role }
+		return sender + " made " + user + " " + role
+	}
+	return ""
+}
+
+// SystemMessage is a membership change, stored in messages with kind
+// 'system', sender_id set to the member who made it and an empty text.
+// Text is rendered when it is sent out.
+type SystemMessage struct {
+	ID             int64
+	ConversationID string
+	SenderID       string
+	Text           string
+	Meta           Meta
+	CreatedAt      time.Time
+}
+
+// Payload is the WebSocket event for m, shaped like a regular message.
+func (m *SystemMessage) Payload() map[string]any {
+	return map[string]any{"type": "message", "kind": "system", "id": m.ID, "conversation_id": m.ConversationID, "sender_id": m.SenderID,
+		"text": m.Text, "meta": m.Meta, "created_at": m.CreatedAt, "expires_at": nil}
+}
+
+type Member struct {
+	UserID      string    `db:"user_id" json:"user_id"`
+	DisplayName string    `db:"display_name" json:"display_name"`
+	Role        string    `db:"role" json:"role"`
+	JoinedAt    time.Time `db:"joined_at" json:"joined_at"`
+}
+
+// NormalizeTitle trims title and checks its length.
+func NormalizeTitle(title string) (string, error) {
+	title = strings.TrimSpace(title)
+	if n := utf8.RuneCountInString(title); n == 0 || n > maxGroupTitle { return "", ErrInvalidTitle }
+	return title, nil
+}
+
+// dedupe drops duplicates and skip from ids, keeping the order.
+func dedupe(ids []string, skip string) []string {
+	seen := map[string]bool{skip: true}
+	out := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if !seen[id] { seen[id] = true; out = append(out, id) }
+	}
+	return out
+}
+
+func displayName(tx *sqlx.Tx, userID string) (string, error) {
+	var (
+		name    string
+		deleted bool
+	)
+	err := tx.QueryRowx(`SELECT COALESCE(display_name,''), deleted_at IS NOT NULL FROM users WHERE id=$1`, userID).Scan(&name, &deleted)
+	return users.DisplayName(name, userID, deleted), err
+}
+
+// system stores a system message and renders its text for the live event.
+func system(tx *sqlx.Tx, convID, senderID string, meta Meta) (*SystemMessage, error) {
+	sender, err := displayName(tx, senderID)
+	if err != nil { return nil, err }
+	var user string
+	if meta.UserID != "" {
+		if user, err = displayName(tx, meta.UserID); err != nil { return nil, err }
+	}
+	b, _ := json.Marshal(meta)
+	m := &SystemMessage{ConversationID: convID, SenderID: senderID, Text: meta.Render(senderID, sender, user), Meta: meta}
+	err = tx.QueryRowx(`INSERT INTO messages(conversation_id, sender_id, text, kind, meta) VALUES($1,$2,'','system',$3) RETURNING id, created_at`,
+		convID, senderID, b).Scan(&m.ID, &m.CreatedAt)
+	return m, err
+}
+
+// CreateGroup creates a group owned by ownerID with memberIDs as members.
+// Callers check that ownerID may add each member.
+func (s *Service) CreateGroup(ownerID, title string, memberIDs []string) (string, []*SystemMessage, error) {
+	title, err := NormalizeTitle(title)
+	if err != nil { return "", nil, err }
+	memberIDs = dedupe(memberIDs, ownerID)
+	if len(memberIDs)+1 > maxGroupMembers { return "", nil, ErrTooManyMembers }
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return "", nil, err }
+	defer tx.Rollback()
+
+	var convID string
+	if err := tx.QueryRowx(`INSERT INTO conversations(type, title) VALUES('group',$1) RETURNING id`, title).Scan(&convID); err != nil { return "", nil, err }
+	if _, err := tx.Exec(`INSERT INTO conversation_participants(conversation_id, user_id, role) VALUES($1,$2,'owner')`, convID, ownerID); err != nil { return "", nil, err }
+	m, err := system(tx, convID, ownerID, Meta{Event: EventGroupCreated})
+	if err != nil { return "", nil, err }
+	msgs := []*SystemMessage{m}
+	for _, id := range memberIDs {
+		if _, err := tx.Exec(`INSERT INTO conversation_participants(conversation_id, user_id) VALUES($1,$2)`, convID, id); err != nil { return "", nil, err }
+		m, err := system(tx, convID, ownerID, Meta{Event: EventMemberAdded, UserID: id})
+		if err != nil { return "", nil, err }
+		msgs = append(msgs, m)
+	}
+	return convID, msgs, tx.Commit()
+}
+
+// lockGroup locks group convID for a membership change and returns userID's
+// role in it.
+func lockGroup(tx *sqlx.Tx, convID, userID string) (string, error) {
+	var (
+		typ  string
+		role *string
+	)
+	err := tx.QueryRowx(`SELECT c.type, p.role FROM conversations c
+		LEFT JOIN conversation_participants p ON p.conversation_id=c.id AND p.user_id=$2
+		WHERE c.id=$1::uuid FOR UPDATE OF c`, convID, userID).Scan(&typ, &role)
+	if errors.Is(err, sql.ErrNoRows) { return "", ErrNotGroup }
+	if err != nil { return "", err }
+	if typ != "group" { return "", ErrNotGroup }
+	if role == nil { return "", ErrNotMember }
+	return *role, nil
+}
+
+// actorRole is lockGroup for the member making a change: not being a member
+// at all is ErrForbidden rather than ErrNotMember.
+func actorRole(tx *sqlx.Tx, convID, actorID string) (string, error) {
+	role, err := lockGroup(tx, convID, actorID)
+	if errors.Is(err, ErrNotMember) { return "", ErrForbidden }
+	return role, err
+}
+
+// AddMembers adds userIDs to the group; only admins and the owner may.
+// Existing members are skipped. Callers check that actorID may add each one.
+func (s *Service) AddMembers(convID, actorID string, userIDs []string) ([]*SystemMessage, error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	role, err := actorRole(tx, convID, actorID)
+	if err != nil { return nil, err }
+	if memberRank[role] < memberRank[MemberAdmin] { return nil, ErrForbidden }
+	var n int
+	if err := tx.QueryRowx(`SELECT count(*) FROM conversation_participants WHERE conversation_id=$1`, convID).Scan(&n); err != nil { return nil, err }
+
+	var msgs []*SystemMessage
+	for _, id := range dedupe(userIDs, actorID) {
+		res, err := tx.Exec(`INSERT INTO conversation_participants(conversation_id, user_id) VALUES($1,$2) ON CONFLICT DO NOTHING`, convID, id)
+		if err != nil { return nil, err }
+		if a, _ := res.RowsAffected(); a == 0 { continue }
+		if n++; n > maxGroupMembers { return nil, ErrTooManyMembers }
+		m, err := system(tx, convID, actorID, Meta{Event: EventMemberAdded, UserID: id})
+		if err != nil { return nil, err }
+		msgs = append(msgs, m)
+	}
+	return msgs, tx.Commit()
+}
+
+// RemoveMember takes userID out of the group. Members may always leave;
+// removing someone else needs a higher role than theirs. An owner who leaves
+// hands the group to the longest-standing admin, or member if there is no
+// admin; the last member leaving deletes the group.
+func (s *Service) RemoveMember(convID, actorID, userID string) ([]*SystemMessage, error) {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	role, err := actorRole(tx, convID, actorID)
+	if err != nil { return nil, err }
+	target := role
+	if userID != actorID {
+		if target, err = lockGroup(tx, convID, userID); err != nil { return nil, err }
+		if memberRank[role] < memberRank[MemberAdmin] || memberRank[role] <= memberRank[target] { return nil, ErrForbidden }
+	}
+	if _, err := tx.Exec(`DELETE FROM conversation_participants WHERE conversation_id=$1 AND user_id=$2`, convID, userID); err != nil { return nil, err }
+
+	event := EventMemberRemoved
+	if userID == actorID { event = EventMemberLeft }
+	m, err := system(tx, convID, actorID, Meta{Event: event, UserID: userID})
+	if err != nil { return nil, err }
+	msgs := []*SystemMessage{m}
+
+	if target == MemberOwner {
+		var next string
+		err := tx.QueryRowx(`SELECT user_id FROM conversation_participants WHERE conversation_id=$1
+			ORDER BY role='admin' DESC, joined_at, user_id LIMIT 1`, convID).Scan(&next)
+		if errors.Is(err, sql.ErrNoRows) {
+			if _, err := tx.Exec(`DELETE FROM conversations WHERE id=$1`, convID); err != nil { return nil, err }
+			return nil, tx.Commit()
+		}
+		if err != nil { return nil, err }
+		if _, err := tx.Exec(`UPDATE conversation_participants SET role='owner' WHERE conversation_id=$1 AND user_id=$2`, convID, next); err != nil { return nil, err }
+		m, err := system(tx, convID, actorID, Meta{Event: EventRoleChanged, UserID: next, Role: MemberOwner})
+		if err != nil { return nil, err }
+		msgs = append(msgs, m)
+	}
+	return msgs, tx.Commit()
+}
+
+// SetMemberRole promotes or demotes userID; only the owner may. Making
+// someone the owner transfers ownership and leaves the old owner an admin.
+func (s *Service) SetMemberRole(convID, actorID, userID, role string) ([]*SystemMessage, error) {
+	if _, ok := memberRank[role]; !ok { return nil, ErrInvalidMemberRole }
+	if userID == actorID { return nil, ErrOwnRole }
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return nil, err }
+	defer tx.Rollback()
+	own, err := actorRole(tx, convID, actorID)
+	if err != nil { return nil, err }
+	if own != MemberOwner { return nil, ErrForbidden }
+	cur, err := lockGroup(tx, convID, userID)
+	if err != nil { return nil, err }
+	if cur == role { return nil, nil }
+	var msgs []*SystemMessage
+	if role == MemberOwner {
+		if _, err := tx.Exec(`UPDATE conversation_participants SET role='admin' WHERE conversation_id=$1 AND user_id=$2`, convID, actorID); err != nil { return nil, err }
+	}
+	if _, err := tx.Exec(`UPDATE conversation_participants SET role=$3 WHERE conversation_id=$1 AND user_id=$2`, convID, userID, role); err != nil { return nil, err }
+	m, err := system(tx, convID, actorID, Meta{Event: EventRoleChanged, UserID: userID, Role: role})
+	if err != nil { return nil, err }
+	msgs = append(msgs, m)
+	if role == MemberOwner {
+		// The old owner's demotion is part of the history too.
+		m, err := system(tx, convID, actorID, Meta{Event: EventRoleChanged, UserID: actorID, Role: MemberAdmin})
+		if err != nil { return nil, err }
+		msgs = append(msgs, m)
+	}
+	return msgs, tx.Commit()
+}
+
+// Members lists convID's participants if viewerID is one of them.
+func (s *Service) Members(convID, viewerID string) ([]Member, error) {
+	ok, err := s.EnsureParticipant(convID, viewerID)
+	if err != nil { return nil, err }
+	if !ok { return nil, ErrForbidden }
+	var rows []struct {
+		Member
+		Deleted bool `db:"deleted"`
+	}
+	err = s.st.DB.Select(&rows, `SELECT p.user_id, COALESCE(u.display_name,'') AS display_name, p.role, p.joined_at, u.deleted_at IS NOT NULL AS deleted
+		FROM conversation_participants p JOIN users u ON u.id=p.user_id
+		WHERE p.conversation_id=$1 ORDER BY array_position(ARRAY['owner','admin','member'], p.role), p.joined_at, p.user_id`, convID)
+	if err != nil { return nil, err }
+	out := make([]Member, 0, len(rows))
+	for _, r := range rows {
+		m := r.Member
+		m.DisplayName = users.DisplayName(m.DisplayName, m.UserID, r.Deleted)
+		out = append(out, m)
+	}
+	return out, nil
+}
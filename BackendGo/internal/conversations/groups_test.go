@@ -0,0 +1,40 @@
+package conversations
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeTitle(t *testing.T) {
+	if got, err := NormalizeTitle("  Design team \n"); err != nil || got != "Design team" { t.Errorf("got %q, %v", got, err) }
+	for _, bad := range []string{"", "   ", strings.Repeat("é", maxGroupTitle+1)} {
+		if _, err := NormalizeTitle(bad); err != ErrInvalidTitle { t.Errorf("%q: %v", bad, err) }
+	}
+	if _, err := NormalizeTitle(strings.Repeat("é", maxGroupTitle)); err != nil { t.Errorf("limit counts runes: %v", err) }
+}
+
+func TestDedupe(t *testing.T) {
+	got := dedupe([]string{"b", "a", "me", "b", "c", "a"}, "me")
+	if want := []string{"b", "a", "c"}; !reflect.DeepEqual(got, want) { t.Errorf("got %v, want %v", got, want) }
+}
+
+func TestMetaRender(t *testing.T) {
+	cases := []struct {
+		meta Meta
+		want string
+	}{
+		{Meta{Event: EventGroupCreated}, "Ann created the group"},
+		{Meta{Event: EventMemberAdded, UserID: "b"}, "Ann added Bob"},
+		{Meta{Event: EventMemberRemoved, UserID: "b"}, "Ann removed Bob"},
+		{Meta{Event: EventMemberLeft, UserID: "a"}, "Ann left"},
+		{Meta{Event: EventRoleChanged, UserID: "b", Role: MemberOwner}, "Ann made Bob the owner"},
+		{Meta{Event: EventRoleChanged, UserID: "b", Role: MemberAdmin}, "Ann made Bob an admin"},
+		{Meta{Event: EventRoleChanged, UserID: "b", Role: MemberMember}, "Ann made Bob a member"},
+	}
+	for _, c := range cases {
+		if got := c.meta.Render("a", "Ann", "Bob"); got != c.want { t.Errorf("%+v: got %q, want %q", c.meta, got, c.want) }
+	}
+	// The old owner's demotion when handing over ownership.
+	if got := (Meta{Event: EventRoleChanged, UserID: "a", Role: MemberAdmin}).Render("a", "Ann", "Ann"); got != "Ann is now an admin" { t.Errorf("got %q", got) }
+}
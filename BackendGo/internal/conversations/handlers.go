@@ -2,11 +2,14 @@ package conversations
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"go-chat-backend/internal/auth"
 	"go-chat-backend/internal/contacts"
+	"go-chat-backend/internal/store"
 )
 
 type startReq struct{ PeerID string `json:"peer_id"` }
@@ -15,9 +18,13 @@ func HandleStartOrGetDirect(s *Service, cs *contacts.Service, jwt *auth.JWT, w h
 	u := r.Context().Value("user").(*auth.Claims)
 	var req startReq
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if !store.IsUUID(req.PeerID) { http.Error(w, "invalid peer_id", http.StatusBadRequest); return nil }
 	ok, err := cs.AreMutual(u.UserID, req.PeerID)
 	if err != nil { return err }
 	if !ok { http.Error(w, "peer is not in contacts", http.StatusForbidden); return nil }
+	if blocked, err := cs.Blocked(u.UserID, req.PeerID); err != nil {
+		return err
+	} else if blocked { http.Error(w, "cannot start a conversation with this user", http.StatusForbidden); return nil }
 	id, err := s.StartOrGetDirect(u.UserID, req.PeerID)
 	if err != nil { return err }
 	return json.NewEncoder(w).Encode(map[string]string{"id": id, "type":"direct"})
@@ -30,4 +37,117 @@ func HandleList(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Reques
 	items, err := s.ListForUser(u.UserID, limit, offset)
 	if err != nil { return err }
 	return json.NewEncoder(w).Encode(items)
-}
\ No newline at end of file
+}
+
+type groupReq struct {
+	Title     string   `json:"title"`
+	MemberIDs []string `json:"member_ids"`
+}
+
+// groupError writes the response for the group errors callers can act on.
+func groupError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, ErrForbidden): http.Error(w, "not allowed to manage this group", http.StatusForbidden)
+	case errors.Is(err, ErrNotGroup), errors.Is(err, ErrNotMember): http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, ErrInvalidTitle), errors.Is(err, ErrInvalidMemberRole), errors.Is(err, ErrTooManyMembers), errors.Is(err, ErrOwnRole):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	default: return false
+	}
+	return true
+}
+
+// checkAddable writes 400 for a malformed id and 403 unless every id is an
+// accepted contact of userID. Blocking removes contacts, so this also keeps
+// blocked users out.
+func checkAddable(cs *contacts.Service, userID string, ids []string, w http.ResponseWriter) (bool, error) {
+	for _, id := range ids {
+		if !store.IsUUID(id) { http.Error(w, "invalid user id "+strconv.Quote(id), http.StatusBadRequest); return false, nil }
+	}
+	for _, id := range ids {
+		if id == userID { continue }
+		ok, err := cs.AreMutual(userID, id)
+		if err != nil { return false, err }
+		if !ok { http.Error(w, "user "+id+" is not in your contacts", http.StatusForbidden); return false, nil }
+	}
+	return true, nil
+}
+
+// publish broadcasts system messages to the group and tells added and
+// removed members, who are not (or no longer) in the conversation's room.
+func publish(n Notifier, msgs []*SystemMessage) {
+	for _, m := range msgs {
+		switch m.Meta.Event {
+		case EventMemberAdded:
+			n.Broadcast(m.ConversationID, m.Payload())
+			n.SendToUser(m.Meta.UserID, map[string]any{"type": "conversation_added", "conversation_id": m.ConversationID})
+		case EventMemberRemoved, EventMemberLeft:
+			n.RemoveFromConversation(m.ConversationID, m.Meta.UserID)
+			n.SendToUser(m.Meta.UserID, map[string]any{"type": "conversation_removed", "conversation_id": m.ConversationID})
+			n.Broadcast(m.ConversationID, m.Payload())
+		default:
+			n.Broadcast(m.ConversationID, m.Payload())
+		}
+	}
+}
+
+// HandleCreateGroup serves POST /api/conversations/groups.
+func HandleCreateGroup(s *Service, cs *contacts.Service, n Notifier, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	var req groupReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if ok, err := checkAddable(cs, u.UserID, req.MemberIDs, w); !ok { return err }
+	id, msgs, err := s.CreateGroup(u.UserID, req.Title, req.MemberIDs)
+	if groupError(w, err) { return nil }
+	if err != nil { return err }
+	publish(n, msgs)
+	title, _ := NormalizeTitle(req.Title)
+	w.WriteHeader(http.StatusCreated)
+	return json.NewEncoder(w).Encode(map[string]string{"id": id, "type": "group", "title": title})
+}
+
+type membersReq struct{ UserIDs []string `json:"user_ids"` }
+type roleReq struct{ Role string `json:"role"` }
+
+// HandleMembers serves /api/conversations/{id}/members: GET lists them, POST
+// adds user_ids; /members/{user_id} takes PATCH {"role"} and DELETE.
+func HandleMembers(s *Service, cs *contacts.Service, n Notifier, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/api/conversations/"), "/"), "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[1] != "members" { http.NotFound(w, r); return nil }
+	convID := parts[0]
+	if !store.IsUUID(convID) || (len(parts) == 3 && !store.IsUUID(parts[2])) { http.Error(w, "not found", http.StatusNotFound); return nil }
+	var (
+		msgs []*SystemMessage
+		err  error
+	)
+	switch {
+	case len(parts) == 2 && r.Method == http.MethodGet:
+		members, err := s.Members(convID, u.UserID)
+		if errors.Is(err, ErrForbidden) { http.Error(w, err.Error(), http.StatusForbidden); return nil }
+		if err != nil { return err }
+		return json.NewEncoder(w).Encode(members)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var req membersReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+		if ok, err := checkAddable(cs, u.UserID, req.UserIDs, w); !ok { return err }
+		msgs, err = s.AddMembers(convID, u.UserID, req.UserIDs)
+	case len(parts) == 3 && r.Method == http.MethodPatch:
+		var req roleReq
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+		msgs, err = s.SetMemberRole(convID, u.UserID, parts[2], req.Role)
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		msgs, err = s.RemoveMember(convID, u.UserID, parts[2])
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed); return nil
+	}
+	if groupError(w, err) { return nil }
+	if err != nil { return err }
+	publish(n, msgs)
+	if r.Method == http.MethodDelete {
+		n.RemoveFromConversation(convID, parts[2]) // also when the group went away with its last member
+		w.WriteHeader(http.StatusNoContent); return nil
+	}
+	members, err := s.Members(convID, u.UserID)
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(members)
+}
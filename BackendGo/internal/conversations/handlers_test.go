@@ -0,0 +1,53 @@
+package conversations
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"go-chat-backend/internal/auth"
+)
+
+type fakeNotifier struct{ calls []string }
+
+func (f *fakeNotifier) Broadcast(convID string, payload any) { f.calls = append(f.calls, "broadcast "+convID) }
+func (f *fakeNotifier) SendToUser(userID string, payload any) {
+	f.calls = append(f.calls, "user "+userID+" "+payload.(map[string]any)["type"].(string))
+}
+func (f *fakeNotifier) RemoveFromConversation(convID, userID string) { f.calls = append(f.calls, "remove "+userID) }
+
+func TestPublish(t *testing.T) {
+	n := &fakeNotifier{}
+	publish(n, []*SystemMessage{
+		{ConversationID: "c", Meta: Meta{Event: EventMemberAdded, UserID: "b"}},
+		{ConversationID: "c", Meta: Meta{Event: EventMemberRemoved, UserID: "d"}},
+		{ConversationID: "c", Meta: Meta{Event: EventRoleChanged, UserID: "e", Role: MemberAdmin}},
+	})
+	want := []string{"broadcast c", "user b conversation_added", "remove d", "user d conversation_removed", "broadcast c", "broadcast c"}
+	if !reflect.DeepEqual(n.calls, want) { t.Errorf("calls = %v, want %v", n.calls, want) }
+}
+
+func TestMalformedIDs(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "user", &auth.Claims{UserID: "3f2a9c1d-0000-4000-8000-000000000000"})
+	cases := []struct {
+		method, path, body string
+		code               int
+	}{
+		{http.MethodGet, "/api/conversations/not-a-uuid/members", "", http.StatusNotFound},
+		{http.MethodDelete, "/api/conversations/3f2a9c1d-0000-4000-8000-000000000001/members/x", "", http.StatusNotFound},
+		{http.MethodPost, "/api/conversations/3f2a9c1d-0000-4000-8000-000000000001/members", `{"user_ids":["x"]}`, http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest(c.method, c.path, strings.NewReader(c.body)).WithContext(ctx)
+		// Neither the services nor the notifier are reached, so nil is fine.
+		if err := HandleMembers(nil, nil, nil, nil, w, r); err != nil { t.Fatalf("%s %s: %v", c.method, c.path, err) }
+		if w.Code != c.code { t.Errorf("%s %s: got %d, want %d", c.method, c.path, w.Code, c.code) }
+	}
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodPost, "/api/conversations/groups", strings.NewReader(`{"title":"x","member_ids":["1"]}`)).WithContext(ctx)
+	if err := HandleCreateGroup(nil, nil, nil, nil, w, r); err != nil || w.Code != http.StatusBadRequest { t.Errorf("create group: %d, %v", w.Code, err) }
+}
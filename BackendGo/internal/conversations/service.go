@@ -6,9 +6,12 @@ import (
 	"sort"
 	"time"
 
+	"go-chat-backend/internal/auth"
 	"go-chat-backend/internal/store"
 )
 
+var ErrForbidden = errors.New("not allowed to access this conversation")
+
 type Service struct{ st *store.Store }
 func NewService(st *store.Store) *Service { return &Service{st: st} }
 
@@ -37,14 +40,45 @@ func (s *Service) EnsureParticipant(convID, userID string) (bool, error) {
 	return true, nil
 }
 
-func (s *Service) ListForUser(userID string, limit, offset int) ([]struct{ ID, Type string; CreatedAt time.Time }, error) {
-	rows, err := s.st.DB.Queryx(`SELECT c.id,c.type,c.created_at FROM conversations c
+// Actions checked by Authorize.
+const (
+	ActionRead     = "read"     // read messages
+	ActionModerate = "moderate" // remove other people's messages
+)
+
+// Authorize reports with ErrForbidden whether userID, holding the global
+// role, may perform action in convID. Reading is for participants only,
+// whatever the role; moderating needs RoleModerator or above.
+func (s *Service) Authorize(convID, userID, role, action string) error {
+	switch action {
+	case ActionRead:
+		ok, err := s.EnsureParticipant(convID, userID)
+		if err != nil { return err }
+		if !ok { return ErrForbidden }
+		return nil
+	case ActionModerate:
+		if !auth.HasRole(role, auth.RoleModerator) { return ErrForbidden }
+		return nil
+	}
+	return ErrForbidden
+}
+
+// Summary is a conversation in a listing; Title and Role are only set for groups.
+type Summary struct {
+	ID, Type  string
+	Title     *string
+	Role      *string
+	CreatedAt time.Time
+}
+
+func (s *Service) ListForUser(userID string, limit, offset int) ([]Summary, error) {
+	rows, err := s.st.DB.Queryx(`SELECT c.id,c.type,c.title,CASE WHEN c.type='group' THEN p.role END,c.created_at FROM conversations c
 		JOIN conversation_participants p ON p.conversation_id=c.id
 		WHERE p.user_id=$1 ORDER BY c.created_at DESC LIMIT $2 OFFSET $3`, userID, limit, offset)
 	if err != nil { return nil, err }
 	defer rows.Close()
-	var out []struct{ ID, Type string; CreatedAt time.Time }
-	for rows.Next() { var id, t string; var ct time.Time; if err := rows.Scan(&id, &t, &ct); err != nil { return nil, err }; out = append(out, struct{ ID, Type string; CreatedAt time.Time }{id,t,ct}) }
+	var out []Summary
+	for rows.Next() { var c Summary; if err := rows.Scan(&c.ID, &c.Type, &c.Title, &c.Role, &c.CreatedAt); err != nil { return nil, err }; out = append(out, c) }
 	return out, rows.Err()
 }
 
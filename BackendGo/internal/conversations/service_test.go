@@ -0,0 +1,16 @@
+package conversations
+
+import (
+	"errors"
+	"testing"
+
+	"go-chat-backend/internal/auth"
+)
+
+func TestAuthorizeModerate(t *testing.T) {
+	s := &Service{} // moderating is decided by role alone, no database needed
+	for role, want := range map[string]error{auth.RoleUser: ErrForbidden, auth.RoleModerator: nil, auth.RoleAdmin: nil} {
+		if err := s.Authorize("c1", "u1", role, ActionModerate); !errors.Is(err, want) { t.Errorf("%s: got %v, want %v", role, err, want) }
+	}
+	if err := s.Authorize("c1", "u1", auth.RoleAdmin, "rename"); !errors.Is(err, ErrForbidden) { t.Errorf("unknown action allowed: %v", err) }
+}
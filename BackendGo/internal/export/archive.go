@@ -0,0 +1,137 @@
+package export
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"html/template"
+	"io"
+	"time"
+
+	"go-chat-backend/internal/privacy"
+)
+
+// Archive is everything we hold about one user. Blocks are only those the
+// user made; being blocked by someone is that person's data.
+type Archive struct {
+	GeneratedAt     time.Time        `json:"generated_at"`
+	Profile         Profile          `json:"profile"`
+	Status          *Status          `json:"status"`
+	Privacy         privacy.Settings `json:"privacy"`
+	Contacts        []Contact        `json:"contacts"`
+	ContactRequests []ContactRequest `json:"contact_requests"`
+	Blocks          []Block          `json:"blocks"`
+	Conversations   []Conversation   `json:"conversations"`
+	Messages        []Message        `json:"messages"`
+}
+
+type Profile struct {
+	ID              string     `db:"id" json:"id"`
+	Email           string     `db:"email" json:"email"`
+	Role            string     `db:"role" json:"role"`
+	CreatedAt       time.Time  `db:"created_at" json:"created_at"`
+	EmailVerifiedAt *time.Time `db:"email_verified_at" json:"email_verified_at"`
+	DisplayName     *string    `db:"display_name" json:"display_name"`
+	AvatarURL       *string    `db:"avatar_url" json:"avatar_url"`
+	Bio             *string    `db:"bio" json:"bio"`
+	Timezone        *string    `db:"timezone" json:"timezone"`
+	Discoverable    bool       `db:"discoverable" json:"discoverable"`
+}
+
+type Status struct {
+	Emoji     string     `db:"emoji" json:"emoji,omitempty"`
+	Text      string     `db:"text" json:"text,omitempty"`
+	ClearsAt  *time.Time `db:"clears_at" json:"clears_at,omitempty"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+type ContactRequest struct {
+	ID          int64      `db:"id" json:"id"`
+	Sent        bool       `db:"sent" json:"sent_by_you"`
+	OtherUserID string     `db:"other_id" json:"other_user_id"`
+	Status      string     `db:"status" json:"status"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	RespondedAt *time.Time `db:"responded_at" json:"responded_at,omitempty"`
+}
+
+type Block struct {
+	UserID    string    `db:"blocked_id" json:"user_id"`
+	BlockedAt time.Time `db:"created_at" json:"blocked_at"`
+}
+
+type Contact struct {
+	ContactID string    `db:"contact_id" json:"contact_id"`
+	Email     string    `db:"email" json:"email"`
+	Nickname  *string   `db:"nickname" json:"nickname,omitempty"`
+	Labels    string    `db:"labels" json:"labels,omitempty"`
+	Favorite  bool      `db:"favorite" json:"favorite,omitempty"`
+	AddedAt   time.Time `db:"created_at" json:"added_at"`
+}
+
+type Conversation struct {
+	ID           string    `db:"id" json:"id"`
+	Type         string    `db:"type" json:"type"`
+	Title        *string   `db:"title" json:"title,omitempty"` // groups only
+	Role         *string   `db:"role" json:"role,omitempty"`   // the user's role in a group
+	CreatedAt    time.Time `db:"created_at" json:"created_at"`
+	Participants []string  `db:"-" json:"participants"`
+}
+
+type Message struct {
+	ID             int64      `db:"id" json:"id"`
+	ConversationID string     `db:"conversation_id" json:"conversation_id"`
+	SenderID       string     `db:"sender_id" json:"sender_id"`
+	Sent           bool       `db:"sent" json:"sent_by_you"`
+	Text           string     `db:"text" json:"text"`
+	CreatedAt      time.Time  `db:"created_at" json:"created_at"`
+	ExpiresAt      *time.Time `db:"expires_at" json:"expires_at,omitempty"`
+}
+
+var indexTmpl = template.Must(template.New("index").Parse(`<!doctype html>
+<html><head><meta charset="utf-8"><title>Go Chat data export</title>
+<style>body{font-family:sans-serif;max-width:60em;margin:2em auto}td,th{padding:.2em .6em;text-align:left;vertical-align:top}</style></head>
+<body>
+<h1>Your Go Chat data</h1>
+<p>Generated {{.GeneratedAt.Format "2 January 2006 15:04 MST"}}. The same data is included as JSON files in this archive.</p>
+<h2>Profile</h2>
+<table><tr><th>ID</th><td>{{.Profile.ID}}</td></tr><tr><th>Email</th><td>{{.Profile.Email}}</td></tr>
+{{with .Profile.DisplayName}}<tr><th>Display name</th><td>{{.}}</td></tr>{{end}}{{with .Profile.Bio}}<tr><th>Bio</th><td>{{.}}</td></tr>{{end}}
+{{with .Profile.Timezone}}<tr><th>Timezone</th><td>{{.}}</td></tr>{{end}}
+<tr><th>Role</th><td>{{.Profile.Role}}</td></tr><tr><th>Member since</th><td>{{.Profile.CreatedAt.Format "2006-01-02"}}</td></tr>
+<tr><th>Listed in search</th><td>{{if .Profile.Discoverable}}yes{{else}}no{{end}}</td></tr>
+{{with .Status}}<tr><th>Status</th><td>{{.Emoji}} {{.Text}}</td></tr>{{end}}</table>
+<h2>Privacy</h2>
+<table><tr><th>Contact requests from</th><td>{{.Privacy.ContactRequests}}</td></tr><tr><th>Last seen visible to</th><td>{{.Privacy.LastSeen}}</td></tr>
+<tr><th>Profile photo visible to</th><td>{{.Privacy.ProfilePhoto}}</td></tr></table>
+<h2>Contacts ({{len .Contacts}})</h2>
+<table>{{range .Contacts}}<tr><td>{{.Email}}</td><td>added {{.AddedAt.Format "2006-01-02"}}</td></tr>{{end}}</table>
+<h2>Contact requests ({{len .ContactRequests}})</h2>
+<table>{{range .ContactRequests}}<tr><td>{{if .Sent}}to{{else}}from{{end}} {{.OtherUserID}}</td><td>{{.Status}}</td><td>{{.CreatedAt.Format "2006-01-02"}}</td></tr>{{end}}</table>
+<h2>Blocked users ({{len .Blocks}})</h2>
+<table>{{range .Blocks}}<tr><td>{{.UserID}}</td><td>since {{.BlockedAt.Format "2006-01-02"}}</td></tr>{{end}}</table>
+<h2>Conversations ({{len .Conversations}})</h2>
+{{range $c := .Conversations}}<h3>{{if $c.Title}}{{$c.Title}} ({{$c.Type}}){{else}}{{$c.Type}} conversation {{$c.ID}}{{end}}</h3>
+<table>{{range $.Messages}}{{if eq .ConversationID $c.ID}}<tr><td>{{.CreatedAt.Format "2006-01-02 15:04"}}</td><td>{{if .Sent}}you{{else}}{{.SenderID}}{{end}}</td><td>{{.Text}}</td></tr>{{end}}{{end}}</table>
+{{end}}
+</body></html>
+`))
+
+// Write streams a as a zip: one JSON file per section plus index.html.
+func (a *Archive) Write(w io.Writer) error {
+	z := zip.NewWriter(w)
+	files := []struct {
+		name string
+		v    any
+	}{{"profile.json", a.Profile}, {"status.json", a.Status}, {"privacy.json", a.Privacy}, {"contacts.json", a.Contacts},
+		{"contact_requests.json", a.ContactRequests}, {"blocks.json", a.Blocks}, {"conversations.json", a.Conversations}, {"messages.json", a.Messages}}
+	for _, f := range files {
+		fw, err := z.CreateHeader(&zip.FileHeader{Name: f.name, Method: zip.Deflate, Modified: a.GeneratedAt})
+		if err != nil { return err }
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil { return err }
+	}
+	fw, err := z.CreateHeader(&zip.FileHeader{Name: "index.html", Method: zip.Deflate, Modified: a.GeneratedAt})
+	if err != nil { return err }
+	if err := indexTmpl.Execute(fw, a); err != nil { return err }
+	return z.Close()
+}
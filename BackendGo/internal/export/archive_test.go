@@ -0,0 +1,42 @@
+package export
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestArchiveWrite(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	a := &Archive{
+		GeneratedAt:   now,
+		Profile:       Profile{ID: "u1", Email: "ann@example.com", Role: "user", CreatedAt: now},
+		Status:        &Status{Emoji: "🌴", Text: "on leave", UpdatedAt: now},
+		Contacts:      []Contact{{ContactID: "u2", Email: "bob@example.com", AddedAt: now}},
+		Blocks:        []Block{{UserID: "u3", BlockedAt: now}},
+		Conversations: []Conversation{{ID: "c1", Type: "direct", CreatedAt: now, Participants: []string{"u1", "u2"}}},
+		Messages:      []Message{{ID: 1, ConversationID: "c1", SenderID: "u2", Text: "<b>hi</b>", CreatedAt: now}},
+	}
+	var buf bytes.Buffer
+	if err := a.Write(&buf); err != nil { t.Fatal(err) }
+	z, err := zip.NewReader(bytes.NewReader(buf.Bytes()), int64(buf.Len()))
+	if err != nil { t.Fatal(err) }
+	files := map[string]string{}
+	for _, f := range z.File {
+		rc, err := f.Open()
+		if err != nil { t.Fatal(err) }
+		b, _ := io.ReadAll(rc)
+		rc.Close()
+		files[f.Name] = string(b)
+	}
+	for _, name := range []string{"profile.json", "status.json", "privacy.json", "contacts.json", "contact_requests.json", "blocks.json", "conversations.json", "messages.json", "index.html"} {
+		if _, ok := files[name]; !ok { t.Errorf("missing %s", name) }
+	}
+	var msgs []Message
+	if err := json.Unmarshal([]byte(files["messages.json"]), &msgs); err != nil || len(msgs) != 1 || msgs[0].Text != "<b>hi</b>" { t.Errorf("messages.json = %q (%v)", files["messages.json"], err) }
+	if html := files["index.html"]; strings.Contains(html, "<b>hi</b>") || !strings.Contains(html, "&lt;b&gt;hi&lt;/b&gt;") { t.Error("index.html does not escape message text") }
+}
@@ -0,0 +1,51 @@
+package export
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go-chat-backend/internal/auth"
+)
+
+// HandleRequest starts an export (POST /api/users/me/export).
+func HandleRequest(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	j, link, err := s.Request(u.UserID)
+	var te *auth.ThrottledError
+	switch {
+	case errors.Is(err, ErrInProgress): http.Error(w, err.Error(), http.StatusConflict); return nil
+	case errors.As(err, &te):
+		w.Header().Set("Retry-After", strconv.Itoa(int(te.RetryAfter.Round(time.Second)/time.Second)))
+		http.Error(w, err.Error(), http.StatusTooManyRequests); return nil
+	case err != nil: return err
+	}
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(map[string]any{"export": j, "download_url": link})
+}
+
+// HandleList shows the caller's exports and their status (GET /api/users/me/export).
+func HandleList(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	jobs, err := s.List(u.UserID)
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(jobs)
+}
+
+// HandleDownload serves GET /api/exports/{id}?token=... . The link itself is
+// the credential so it can be opened straight from the notification mail.
+func HandleDownload(s *Service, w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead { w.WriteHeader(http.StatusMethodNotAllowed); return }
+	id := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
+	f, created, err := s.Open(id, r.URL.Query().Get("token"))
+	if err != nil { http.Error(w, ErrInvalidLink.Error(), http.StatusNotFound); return }
+	defer f.Close()
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="go-chat-export-`+created.Format("2006-01-02")+`.zip"`)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Referrer-Policy", "no-referrer")
+	http.ServeContent(w, r, "", created, f)
+}
@@ -0,0 +1,214 @@
+package export
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"go-chat-backend/internal/auth"
+	"go-chat-backend/internal/mail"
+	"go-chat-backend/internal/privacy"
+	"go-chat-backend/internal/store"
+)
+
+// exportMinGap limits how often one user can start an export; building one
+// reads every message they can see.
+const exportMinGap = time.Hour
+
+// exportStaleAfter is when a pending export counts as lost: builds run in the
+// process that took the request, so a restart abandons them.
+const exportStaleAfter = time.Hour
+
+var (
+	ErrInProgress  = errors.New("an export is already being prepared")
+	ErrInvalidLink = errors.New("invalid or expired download link")
+)
+
+// Service builds personal data archives in the background and serves them
+// through unguessable, expiring links. Only the link token's hash is stored.
+type Service struct {
+	st      *store.Store
+	mailer  mail.Sender
+	dir     string        // where finished archives are kept
+	baseURL string        // prefix for download links
+	linkTTL time.Duration // how long a download link stays valid
+}
+
+func NewService(st *store.Store, mailer mail.Sender, dir, baseURL string, linkTTL time.Duration) *Service {
+	return &Service{st: st, mailer: mailer, dir: dir, baseURL: baseURL, linkTTL: linkTTL}
+}
+
+type Job struct {
+	ID          string     `db:"id" json:"id"`
+	Status      string     `db:"status" json:"status"`
+	SizeBytes   *int64     `db:"size_bytes" json:"size_bytes,omitempty"`
+	Error       *string    `db:"error" json:"error,omitempty"`
+	CreatedAt   time.Time  `db:"created_at" json:"created_at"`
+	CompletedAt *time.Time `db:"completed_at" json:"completed_at,omitempty"`
+	ExpiresAt   time.Time  `db:"expires_at" json:"expires_at"`
+}
+
+// Request starts building an archive for userID and returns the job with its
+// download link. The link works once the job is ready; it is mailed then too.
+func (s *Service) Request(userID string) (*Job, string, error) {
+	var (
+		pending bool
+		last    *time.Time
+	)
+	if err := s.st.DB.QueryRowx(`SELECT COALESCE(bool_or(status='pending' AND created_at > $2), false), max(created_at) FROM data_exports WHERE user_id=$1`,
+		userID, time.Now().UTC().Add(-exportStaleAfter)).
+		Scan(&pending, &last); err != nil { return nil, "", err }
+	if pending { return nil, "", ErrInProgress }
+	if last != nil {
+		if wait := exportMinGap - time.Since(*last); wait > 0 { return nil, "", &auth.ThrottledError{RetryAfter: wait} }
+	}
+
+	token, hash, err := auth.NewOpaqueToken()
+	if err != nil { return nil, "", err }
+	j := &Job{}
+	if err := s.st.DB.QueryRowx(`INSERT INTO data_exports(user_id, token_hash, expires_at) VALUES($1,$2,$3)
+		RETURNING id, status, size_bytes, error, created_at, completed_at, expires_at`, userID, hash, time.Now().UTC().Add(s.linkTTL)).StructScan(j); err != nil {
+		return nil, "", err
+	}
+	link := s.baseURL + "/api/exports/" + j.ID + "?token=" + url.QueryEscape(token)
+	go s.build(j.ID, userID, link)
+	return j, link, nil
+}
+
+// List returns userID's exports, newest first.
+func (s *Service) List(userID string) ([]Job, error) {
+	out := []Job{}
+	err := s.st.DB.Select(&out, `SELECT id, status, size_bytes, error, created_at, completed_at, expires_at FROM data_exports
+		WHERE user_id=$1 AND expires_at > now() ORDER BY created_at DESC`, userID)
+	return out, err
+}
+
+func (s *Service) build(id, userID, link string) {
+	defer func() {
+		if p := recover(); p != nil { log.Printf("export %s: panic: %v", id, p); s.fail(id) }
+	}()
+	size, err := s.writeArchive(id, userID)
+	if err != nil {
+		log.Printf("export %s: %v", id, err)
+		s.fail(id)
+		return
+	}
+	var email string
+	var expires time.Time
+	if err := s.st.DB.QueryRowx(`UPDATE data_exports e SET status='ready', file_path=$2, size_bytes=$3, completed_at=now()
+		FROM users u WHERE e.id=$1 AND u.id=e.user_id RETURNING u.email, e.expires_at`, id, s.path(id), size).Scan(&email, &expires); err != nil {
+		log.Printf("export %s: %v", id, err); return
+	}
+	if err := s.mailer.Send(mail.Message{To: email, Subject: "Your Go Chat data export is ready", Body: fmt.Sprintf(
+		"The archive with your Go Chat data is ready:\n%s\n\nThe link expires on %s. Anyone with the link can download the archive, so do not share it.\n",
+		link, expires.Format("2 January 2006 15:04 MST"))}); err != nil {
+		log.Printf("export ready mail: %v", err)
+	}
+}
+
+func (s *Service) fail(id string) {
+	_, _ = s.st.DB.Exec(`UPDATE data_exports SET status='failed', error='could not build the archive', completed_at=now() WHERE id=$1`, id)
+}
+
+// failStale marks exports whose build was abandoned as failed so the user
+// can ask again.
+func (s *Service) failStale() error {
+	_, err := s.st.DB.Exec(`UPDATE data_exports SET status='failed', error='could not build the archive', completed_at=now()
+		WHERE status='pending' AND created_at < $1`, time.Now().UTC().Add(-exportStaleAfter))
+	return err
+}
+
+func (s *Service) path(id string) string { return filepath.Join(s.dir, id+".zip") }
+
+// writeArchive collects the data and writes it next to its final name first,
+// so a half-written file is never served.
+func (s *Service) writeArchive(id, userID string) (int64, error) {
+	a, err := s.collect(userID)
+	if err != nil { return 0, err }
+	if err := os.MkdirAll(s.dir, 0o700); err != nil { return 0, err }
+	tmp := s.path(id) + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil { return 0, err }
+	if err := a.Write(f); err != nil { f.Close(); os.Remove(tmp); return 0, err }
+	st, err := f.Stat()
+	if err == nil { err = f.Close() } else { f.Close() }
+	if err != nil { os.Remove(tmp); return 0, err }
+	return st.Size(), os.Rename(tmp, s.path(id))
+}
+
+func (s *Service) collect(userID string) (*Archive, error) {
+	a := &Archive{GeneratedAt: time.Now().UTC(), Privacy: privacy.Defaults, Contacts: []Contact{}, ContactRequests: []ContactRequest{}, Blocks: []Block{},
+		Conversations: []Conversation{}, Messages: []Message{}}
+	db := s.st.DB
+	if err := db.Get(&a.Profile, `SELECT id, email, role, created_at, email_verified_at, display_name, avatar_url, bio, timezone, discoverable FROM users WHERE id=$1`, userID); err != nil { return nil, err }
+	var st Status
+	if err := db.Get(&st, `SELECT emoji, text, clears_at, updated_at FROM user_status WHERE user_id=$1`, userID); err == nil {
+		a.Status = &st
+	} else if !errors.Is(err, sql.ErrNoRows) { return nil, err }
+	if err := db.Get(&a.Privacy, `SELECT contact_requests, last_seen, profile_photo FROM user_privacy WHERE user_id=$1`, userID); err != nil && !errors.Is(err, sql.ErrNoRows) { return nil, err }
+	// A decline is only shown to the recipient, so sent ones read "closed".
+	if err := db.Select(&a.ContactRequests, `SELECT id, requester_id=$1 AS sent, CASE WHEN requester_id=$1 THEN recipient_id ELSE requester_id END AS other_id,
+		CASE WHEN requester_id=$1 AND status='declined' THEN 'closed' ELSE status END AS status, created_at, responded_at
+		FROM contact_requests WHERE requester_id=$1 OR recipient_id=$1 ORDER BY created_at`, userID); err != nil { return nil, err }
+	if err := db.Select(&a.Blocks, `SELECT blocked_id, created_at FROM user_blocks WHERE blocker_id=$1 ORDER BY created_at`, userID); err != nil { return nil, err }
+	if err := db.Select(&a.Contacts, `SELECT c.contact_id, u.email, c.nickname, array_to_string(c.labels, ', ') AS labels, c.favorite, c.created_at FROM contacts c JOIN users u ON u.id=c.contact_id
+		WHERE c.owner_id=$1 ORDER BY c.created_at`, userID); err != nil { return nil, err }
+	if err := db.Select(&a.Conversations, `SELECT c.id, c.type, c.title, CASE WHEN c.type='group' THEN p.role END AS role, c.created_at FROM conversations c
+		JOIN conversation_participants p ON p.conversation_id=c.id WHERE p.user_id=$1 ORDER BY c.created_at`, userID); err != nil { return nil, err }
+	var members []struct {
+		ConversationID string `db:"conversation_id"`
+		UserID         string `db:"user_id"`
+	}
+	if err := db.Select(&members, `SELECT conversation_id, user_id FROM conversation_participants
+		WHERE conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id=$1)`, userID); err != nil { return nil, err }
+	byConv := map[string][]string{}
+	for _, m := range members { byConv[m.ConversationID] = append(byConv[m.ConversationID], m.UserID) }
+	for i := range a.Conversations { a.Conversations[i].Participants = byConv[a.Conversations[i].ID] }
+	// Everything they sent, plus everything currently visible to them.
+	if err := db.Select(&a.Messages, `SELECT id, conversation_id, sender_id, sender_id=$1 AS sent, text, created_at, expires_at FROM messages
+		WHERE deleted_at IS NULL AND (expires_at IS NULL OR expires_at > now())
+		AND (sender_id=$1 OR conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id=$1))
+		ORDER BY conversation_id, created_at`, userID); err != nil { return nil, err }
+	return a, nil
+}
+
+// Open returns the finished archive behind a download link.
+func (s *Service) Open(id, token string) (*os.File, time.Time, error) {
+	var (
+		hash    string
+		path    *string
+		created time.Time
+	)
+	err := s.st.DB.QueryRowx(`SELECT token_hash, file_path, created_at FROM data_exports WHERE id=$1::uuid AND status='ready' AND expires_at > now()`, id).
+		Scan(&hash, &path, &created)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (path == nil || subtle.ConstantTimeCompare([]byte(hash), []byte(auth.HashToken(token))) != 1)) {
+		return nil, time.Time{}, ErrInvalidLink
+	}
+	if err != nil { return nil, time.Time{}, err }
+	f, err := os.Open(*path)
+	return f, created, err
+}
+
+// StartExportPurger deletes expired archives and their rows and fails
+// abandoned builds, at startup and then every interval.
+func StartExportPurger(s *Service, every time.Duration) {
+	if err := s.failStale(); err != nil { log.Printf("export purger: %v", err) }
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		if err := s.failStale(); err != nil { log.Printf("export purger: %v", err) }
+		var paths []*string
+		if err := s.st.DB.Select(&paths, `DELETE FROM data_exports WHERE expires_at < now() RETURNING file_path`); err != nil {
+			log.Printf("export purger: %v", err); continue
+		}
+		for _, p := range paths {
+			if p != nil { if err := os.Remove(*p); err != nil && !os.IsNotExist(err) { log.Printf("export purger: %v", err) } }
+		}
+	}
+}
@@ -2,8 +2,10 @@ package httputil
 
 import (
 	"encoding/json"
+	"errors"
 	"net"
 	"net/http"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
@@ -35,34 +37,93 @@ func Chain(mws ...Middleware) func(http.Handler) http.Handler {
 	}
 }
 
-// JWTAuth protects /api/*
+// JWTAuth protects /api/*. Personal access tokens are only accepted when
+// pats is non-nil; pair it with RequireScope so routes opt in explicitly.
 
-func JWTAuth(jwt *auth.JWT) Middleware {
+func JWTAuth(jwt *auth.JWT, rev *auth.Revoker, pats *auth.PATs) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			h := r.Header.Get("Authorization")
 			if !strings.HasPrefix(h, "Bearer ") { http.Error(w, "missing bearer", http.StatusUnauthorized); return }
 			tok := strings.TrimPrefix(h, "Bearer ")
-			claims, err := jwt.Parse(tok)
-			if err != nil { http.Error(w, "invalid token", http.StatusUnauthorized); return }
+			var (
+				claims *auth.Claims
+				err    error
+			)
+			if auth.IsPAT(tok) {
+				if pats == nil { http.Error(w, "access tokens are not accepted here", http.StatusForbidden); return }
+				claims, err = pats.Authenticate(tok)
+				if errors.Is(err, auth.ErrInvalidPAT) { http.Error(w, "invalid token", http.StatusUnauthorized); return }
+				if err != nil { http.Error(w, "auth check failed", http.StatusInternalServerError); return }
+			} else {
+				claims, err = jwt.Parse(tok)
+				if err != nil { http.Error(w, "invalid token", http.StatusUnauthorized); return }
+				if err := rev.Check(claims); err != nil {
+					if errors.Is(err, auth.ErrTokenRevoked) { http.Error(w, "invalid token", http.StatusUnauthorized); return }
+					http.Error(w, "auth check failed", http.StatusInternalServerError); return
+				}
+			}
 			r = r.WithContext(context.WithValue(r.Context(), "user", claims))
 			next.ServeHTTP(w, r)
 		})
 	}
 }
 
+// RequireScope checks "<resource>:read" for GET/HEAD and "<resource>:write"
+// for everything else. Interactive logins carry every scope.
+
+func RequireScope(resource string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scope := resource + ":write"
+			if r.Method == http.MethodGet || r.Method == http.MethodHead { scope = resource + ":read" }
+			if c, ok := r.Context().Value("user").(*auth.Claims); !ok || !c.HasScope(scope) {
+				http.Error(w, "token lacks scope "+scope, http.StatusForbidden); return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireRole rejects callers whose role is below role. Roles come from the
+// access token, so changes apply from the next refresh.
+
+func RequireRole(role string) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, ok := r.Context().Value("user").(*auth.Claims); !ok || !auth.HasRole(c.Role, role) {
+				http.Error(w, "requires role "+role, http.StatusForbidden); return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 // CORS
 
+// OriginAllowed reports whether origin is in allowed, a comma-separated list
+// of origins or "*" for any.
+func OriginAllowed(allowed, origin string) bool {
+	if allowed == "*" { return true }
+	if origin == "" { return false }
+	for _, o := range strings.Split(allowed, ",") {
+		if strings.EqualFold(strings.TrimRight(strings.TrimSpace(o), "/"), origin) { return true }
+	}
+	return false
+}
+
 func CORS(allowed string) Middleware {
 	allowAll := allowed == "*"
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			origin := r.Header.Get("Origin")
-			if allowAll || strings.Contains(allowed, origin) {
+			if OriginAllowed(allowed, origin) {
 				w.Header().Set("Access-Control-Allow-Origin", origin)
 				w.Header().Set("Vary", "Origin")
 				w.Header().Set("Access-Control-Allow-Headers", "Authorization, Content-Type")
-				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,DELETE,OPTIONS")
+				w.Header().Set("Access-Control-Allow-Methods", "GET,POST,PATCH,PUT,DELETE,OPTIONS")
+				// Listed origins may send cookies (the single sign-on state).
+				if !allowAll { w.Header().Set("Access-Control-Allow-Credentials", "true") }
 			}
 			if r.Method == http.MethodOptions { w.WriteHeader(http.StatusNoContent); return }
 			next.ServeHTTP(w, r)
@@ -75,6 +136,20 @@ func CORS(allowed string) Middleware {
 type tokenBucket struct{ mu sync.Mutex; tokens int; last time.Time }
 
 func RateLimit(n int, per time.Duration) Middleware {
+	return rateLimit(n, per, func(r *http.Request) string { ip, _, _ := net.SplitHostPort(r.RemoteAddr); return ip })
+}
+
+// RateLimitUser keys the buckets by authenticated user instead of IP, so one
+// account cannot spread requests over many addresses. Place it after JWTAuth.
+func RateLimitUser(n int, per time.Duration) Middleware {
+	return rateLimit(n, per, func(r *http.Request) string {
+		if c, ok := r.Context().Value("user").(*auth.Claims); ok { return "user:" + c.UserID }
+		ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+		return ip
+	})
+}
+
+func rateLimit(n int, per time.Duration, keyOf func(*http.Request) string) Middleware {
 	buckets := make(map[string]*tokenBucket)
 	var mu sync.Mutex
 	refill := func(b *tokenBucket) {
@@ -84,13 +159,18 @@ func RateLimit(n int, per time.Duration) Middleware {
 	}
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			ip, _, _ := net.SplitHostPort(r.RemoteAddr)
+			key := keyOf(r)
 			mu.Lock()
-			b := buckets[ip]
-			if b == nil { b = &tokenBucket{tokens: n, last: time.Now()}; buckets[ip] = b }
+			b := buckets[key]
+			if b == nil { b = &tokenBucket{tokens: n, last: time.Now()}; buckets[key] = b }
 			b.mu.Lock(); mu.Unlock()
 			refill(b)
-			if b.tokens <= 0 { b.mu.Unlock(); http.Error(w, "rate limit", http.StatusTooManyRequests); return }
+			if b.tokens <= 0 {
+				wait := per - time.Since(b.last)
+				b.mu.Unlock()
+				w.Header().Set("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+				http.Error(w, "rate limit", http.StatusTooManyRequests); return
+			}
 			b.tokens--; b.mu.Unlock()
 			next.ServeHTTP(w, r)
 		})
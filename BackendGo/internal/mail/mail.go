@@ -0,0 +1,97 @@
+package mail
+
+import (
+	"fmt"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+type Message struct {
+	To      string
+	Subject string
+	Body    string // plain text
+}
+
+// Sender delivers transactional mail (password resets, verification links).
+type Sender interface {
+	Send(m Message) error
+}
+
+// render formats m as an RFC 5322 message.
+func render(from string, m Message, now time.Time) []byte {
+	var b strings.Builder
+	fmt.Fprintf(&b, "From: %s\r\nTo: %s\r\nSubject: %s\r\nDate: %s\r\n", from, m.To, m.Subject, now.Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n")
+	b.WriteString(strings.ReplaceAll(m.Body, "\n", "\r\n"))
+	return []byte(b.String())
+}
+
+func validHeader(m Message) error {
+	if strings.ContainsAny(m.To+m.Subject, "\r\n") { return fmt.Errorf("mail: invalid header value") }
+	return nil
+}
+
+// SMTP sends through a relay; Username may be empty for unauthenticated relays.
+type SMTP struct {
+	Addr     string // host:port
+	Username string
+	Password string
+	From     string
+}
+
+func NewSMTP(addr, username, password, from string) *SMTP {
+	return &SMTP{Addr: addr, Username: username, Password: password, From: from}
+}
+
+func (s *SMTP) Send(m Message) error {
+	if err := validHeader(m); err != nil { return err }
+	var a smtp.Auth
+	if s.Username != "" {
+		host := s.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 { host = host[:i] }
+		a = smtp.PlainAuth("", s.Username, s.Password, host)
+	}
+	return smtp.SendMail(s.Addr, a, s.From, []string{m.To}, render(s.From, m, time.Now()))
+}
+
+// File writes each message as an .eml file so links can be followed locally
+// without a mail provider.
+type File struct {
+	Dir  string
+	From string
+}
+
+func NewFile(dir, from string) *File { return &File{Dir: dir, From: from} }
+
+func (f *File) Send(m Message) error {
+	if err := validHeader(m); err != nil { return err }
+	if err := os.MkdirAll(f.Dir, 0o750); err != nil { return err }
+	now := time.Now()
+	name := fmt.Sprintf("%s-%s.eml", now.UTC().Format("20060102T150405.000000000"), strings.NewReplacer("@", "_at_", "/", "_").Replace(m.To))
+	return os.WriteFile(filepath.Join(f.Dir, name), render(f.From, m, now), 0o640)
+}
+
+// Memory keeps messages in memory; meant for tests.
+type Memory struct {
+	mu   sync.Mutex
+	sent []Message
+}
+
+func NewMemory() *Memory { return &Memory{} }
+
+func (m *Memory) Send(msg Message) error {
+	if err := validHeader(msg); err != nil { return err }
+	m.mu.Lock(); defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+// Sent returns a copy of everything sent so far.
+func (m *Memory) Sent() []Message {
+	m.mu.Lock(); defer m.mu.Unlock()
+	return append([]Message(nil), m.sent...)
+}
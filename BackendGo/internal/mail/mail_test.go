@@ -0,0 +1,26 @@
+package mail
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFileSenderWritesEML(t *testing.T) {
+	dir := t.TempDir()
+	f := NewFile(dir, "noreply@example.com")
+	if err := f.Send(Message{To: "bob@example.com", Subject: "Hi", Body: "line1\nline2"}); err != nil { t.Fatal(err) }
+	files, _ := filepath.Glob(filepath.Join(dir, "*.eml"))
+	if len(files) != 1 { t.Fatalf("files = %v", files) }
+	b, _ := os.ReadFile(files[0])
+	for _, want := range []string{"To: bob@example.com\r\n", "Subject: Hi\r\n", "\r\n\r\nline1\r\nline2"} {
+		if !strings.Contains(string(b), want) { t.Errorf("missing %q in %q", want, b) }
+	}
+}
+
+func TestRejectsHeaderInjection(t *testing.T) {
+	m := NewMemory()
+	if err := m.Send(Message{To: "a@example.com\r\nBcc: x@example.com", Subject: "s"}); err == nil { t.Fatal("header injection accepted") }
+	if len(m.Sent()) != 0 { t.Fatal("message recorded") }
+}
@@ -2,37 +2,62 @@ package messages
 
 import (
 	"encoding/json"
+	"errors"
 	"net/http"
 	"strconv"
 	"strings"
 	"time"
 
 	"go-chat-backend/internal/auth"
+	"go-chat-backend/internal/conversations"
+	"go-chat-backend/internal/users"
 	"go-chat-backend/internal/ws"
 )
 
 type createReq struct{ ConversationID, Text string; TTLSeconds *int64 `json:"ttl_seconds"` }
 
-func HandleList(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+func HandleList(s *Service, hub *ws.Hub, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
 	convID := r.URL.Query().Get("conversation_id")
 	limit, _ := strconv.Atoi(r.URL.Query().Get("limit")); if limit<=0||limit>200 { limit=50 }
 	var before *time.Time
 	if v := r.URL.Query().Get("before"); v != "" { if ts, err := time.Parse(time.RFC3339Nano, v); err==nil { before=&ts } }
-	rows, err := s.List(convID, limit, before)
+	rows, err := s.List(hub.Conversations, convID, u.UserID, u.Role, limit, before)
+	if errors.Is(err, ErrForbidden) { http.Error(w, "not in conversation", http.StatusForbidden); return nil }
 	if err != nil { return err }
 	defer rows.Close()
 	var out []map[string]any
 	for rows.Next() {
 		var m struct{
-			ID int64 `db:"id"`
-			ConversationID, SenderID, Text string
-			CreatedAt time.Time
-			ExpiresAt, DeletedAt *time.Time
+			ID             int64      `db:"id"`
+			ConversationID string     `db:"conversation_id"`
+			SenderID       string     `db:"sender_id"`
+			Text           string     `db:"text"`
+			Kind           string     `db:"kind"` // "text" or "system"
+			Meta           *string    `db:"meta"`
+			CreatedAt      time.Time  `db:"created_at"`
+			ExpiresAt      *time.Time `db:"expires_at"`
+			DeletedAt      *time.Time `db:"deleted_at"`
+			SenderDeleted  bool       `db:"sender_deleted"` // tombstoned account
+			SenderName     string     `db:"sender_name"`
+			SenderAvatar   *string    `db:"sender_avatar"`
+			AboutID        string     `db:"about_id"` // system messages: the member it is about
+			AboutName      string     `db:"about_name"`
+			AboutDeleted   bool       `db:"about_deleted"`
 		}
 		if err := rows.StructScan(&m); err != nil { return err }
-		out = append(out, map[string]any{
-			"id": m.ID, "conversation_id": m.ConversationID, "sender_id": m.SenderID, "text": m.Text, "created_at": m.CreatedAt, "expires_at": m.ExpiresAt,
-		})
+		item := map[string]any{
+			"id": m.ID, "conversation_id": m.ConversationID, "sender_id": m.SenderID, "sender_deleted": m.SenderDeleted, "text": m.Text, "created_at": m.CreatedAt, "expires_at": m.ExpiresAt,
+			"sender": newSender(m.SenderID, m.SenderName, m.SenderAvatar, m.SenderDeleted), "kind": m.Kind,
+		}
+		if m.Meta != nil { item["meta"] = json.RawMessage(*m.Meta) }
+		if m.Kind == "system" && m.Meta != nil {
+			var meta conversations.Meta
+			if err := json.Unmarshal([]byte(*m.Meta), &meta); err != nil { return err }
+			sender := item["sender"].(*Sender)
+			item["text"] = meta.Render(m.SenderID, sender.DisplayName, users.DisplayName(m.AboutName, m.AboutID, m.AboutDeleted))
+		}
+		out = append(out, item)
 	}
 	return json.NewEncoder(w).Encode(out)
 }
@@ -44,18 +69,27 @@ func HandleCreate(s *Service, hub *ws.Hub, jwt *auth.JWT, w http.ResponseWriter,
 	var ttl time.Duration
 	if req.TTLSeconds != nil { ttl = time.Duration(*req.TTLSeconds) * time.Second }
 	id, created, expires, err := s.Create(hub.Conversations, req.ConversationID, u.UserID, req.Text, ttl)
+	if errors.Is(err, ErrBlocked) { http.Error(w, err.Error(), http.StatusForbidden); return nil }
 	if err != nil { return err }
-	payload := map[string]any{"type":"message","id":id,"text":req.Text,"sender_id":u.UserID,"created_at":created,"expires_at":expires}
+	sender, err := s.Sender(u.UserID)
+	if err != nil { return err }
+	payload := map[string]any{"type":"message","kind":"text","id":id,"text":req.Text,"sender_id":u.UserID,"sender":sender,"created_at":created,"expires_at":expires}
 	hub.Broadcast(req.ConversationID, payload)
 	w.WriteHeader(http.StatusCreated)
 	return json.NewEncoder(w).Encode(payload)
 }
 
-func HandleDelete(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+func HandleDelete(s *Service, hub *ws.Hub, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
 	u := r.Context().Value("user").(*auth.Claims)
 	idStr := r.URL.Path[strings.LastIndex(r.URL.Path, "/")+1:]
 	id, _ := strconv.ParseInt(idStr, 10, 64)
-	if err := s.SoftDelete(id, u.UserID); err != nil { return err }
+	convID, err := s.SoftDelete(hub.Conversations, id, u.UserID, u.Role)
+	switch {
+	case errors.Is(err, ErrNotFound): http.Error(w, err.Error(), http.StatusNotFound); return nil
+	case errors.Is(err, ErrForbidden): http.Error(w, "not allowed to delete this message", http.StatusForbidden); return nil
+	case err != nil: return err
+	}
+	hub.Broadcast(convID, map[string]any{"type": "message_deleted", "id": id, "deleted_by": u.UserID})
 	w.WriteHeader(http.StatusNoContent)
 	return nil
 }
\ No newline at end of file
@@ -1,27 +1,18 @@
 package messages
 
 import (
-	"errors"
+	"strings"
 	"testing"
-	"time"
 )
 
-type fakeConv struct{}
-func (f *fakeConv) EnsureParticipant(convID, userID string) (bool, error) { return true, nil }
-func (f *fakeConv) IsDirect(convID string) (bool, error) { return true, nil }
-func (f *fakeConv) PeerInDirect(convID, self string) (string, error) { return "peer", nil }
-
-type fakeDB struct{ hasContact bool }
-
-// Minimal integration via Service using an in-memory stub is out of scope; here we validate logic shape.
-// In real tests, use a test DB container.
-
-func TestPolicyRequiresContactForDirect(t *testing.T) {
+// The direct-message policy itself (block, then mutual contacts) is one query
+// in Create and needs a database; what runs before it is checked here. A nil
+// conversations service and store would panic if Create got that far.
+func TestCreateValidatesTextFirst(t *testing.T) {
 	s := &Service{st: nil}
-	sCreate := func(has bool) error {
-		if !has { return errors.New("peer not in contacts") }
-		return nil
+	for _, text := range []string{"", strings.Repeat("x", 5*1024+1)} {
+		if _, _, _, err := s.Create(nil, "c1", "u1", text, 0); err == nil || err.Error() != "invalid text size" {
+			t.Errorf("%d bytes: got %v", len(text), err)
+		}
 	}
-	_ = sCreate
-	_ = time.Now
-}
\ No newline at end of file
+}
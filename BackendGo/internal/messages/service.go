@@ -3,24 +3,76 @@ package messages
 import (
 	"database/sql"
 	"errors"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/jmoiron/sqlx"
+	"go-chat-backend/internal/contacts"
 	"go-chat-backend/internal/conversations"
+	"go-chat-backend/internal/privacy"
 	"go-chat-backend/internal/store"
+	"go-chat-backend/internal/users"
+)
+
+var (
+	ErrForbidden = errors.New("not allowed")
+	ErrNotFound  = errors.New("message not found")
+	ErrBlocked   = errors.New("you blocked this user; unblock them first")
 )
 
 type Service struct{ st *store.Store }
 func NewService(st *store.Store) *Service { return &Service{st: st} }
 
-func (s *Service) List(convID string, limit int, before *time.Time) (*sqlx.Rows, error) {
-	q := `SELECT id, conversation_id, sender_id, text, created_at, expires_at, deleted_at
-		FROM messages WHERE conversation_id=$1 AND (deleted_at IS NULL) AND (expires_at IS NULL OR expires_at>now())`
-	args := []any{convID}
-	if before != nil { q += " AND created_at < $2"; args = append(args, *before) }
-	q += " ORDER BY created_at DESC LIMIT $3"
+// Sender is the display info embedded in message payloads so clients do not
+// need a profile lookup per message.
+type Sender struct {
+	ID          string  `json:"id"`
+	DisplayName string  `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Deleted     bool    `json:"deleted,omitempty"`
+}
+
+func newSender(id, name string, avatar *string, deleted bool) *Sender {
+	if deleted { avatar = nil }
+	return &Sender{ID: id, DisplayName: users.DisplayName(name, id, deleted), AvatarURL: avatar, Deleted: deleted}
+}
+
+// Sender looks up the display info for userID. It goes to every member of a
+// conversation, so the avatar is only included if userID shows it to everyone.
+func (s *Service) Sender(userID string) (*Sender, error) {
+	var (
+		name    string
+		avatar  *string
+		deleted bool
+	)
+	err := s.st.DB.QueryRowx(`SELECT COALESCE(display_name,''), CASE WHEN `+privacy.VisibleSQL(privacy.ProfilePhoto, "NULL::uuid", "u.id")+` THEN avatar_url END,
+		deleted_at IS NOT NULL FROM users u WHERE id=$1`, userID).
+		Scan(&name, &avatar, &deleted)
+	if err != nil { return nil, err }
+	return newSender(userID, name, avatar, deleted), nil
+}
+
+// List returns a page of convID's messages if viewerID may read it. Group
+// members only see what was posted since they (last) joined. System
+// messages come with the member they are about as about_name/about_deleted.
+func (s *Service) List(convSvc *conversations.Service, convID, viewerID, role string, limit int, before *time.Time) (*sqlx.Rows, error) {
+	if err := convSvc.Authorize(convID, viewerID, role, conversations.ActionRead); err != nil {
+		if errors.Is(err, conversations.ErrForbidden) { return nil, ErrForbidden }
+		return nil, err
+	}
+	q := `SELECT m.id, m.conversation_id, m.sender_id, m.text, m.kind, m.meta::text AS meta, m.created_at, m.expires_at, m.deleted_at, u.deleted_at IS NOT NULL AS sender_deleted,
+		COALESCE(u.display_name,'') AS sender_name, CASE WHEN `+privacy.VisibleSQL(privacy.ProfilePhoto, "$2::uuid", "u.id")+` THEN u.avatar_url END AS sender_avatar,
+		COALESCE(a.id::text,'') AS about_id, COALESCE(a.display_name,'') AS about_name, COALESCE(a.deleted_at IS NOT NULL, false) AS about_deleted
+		FROM messages m JOIN users u ON u.id=m.sender_id
+		LEFT JOIN users a ON m.kind='system' AND a.id=(m.meta->>'user_id')::uuid
+		WHERE m.conversation_id=$1 AND (m.deleted_at IS NULL) AND (m.expires_at IS NULL OR m.expires_at>now())
+		  AND NOT EXISTS(SELECT 1 FROM conversations c JOIN conversation_participants p ON p.conversation_id=c.id AND p.user_id=$2
+			WHERE c.id=m.conversation_id AND c.type='group' AND m.created_at < p.joined_at)`
+	args := []any{convID, viewerID}
+	if before != nil { q += " AND m.created_at < $3"; args = append(args, *before) }
 	args = append(args, limit)
+	q += " ORDER BY m.created_at DESC LIMIT $" + strconv.Itoa(len(args))
 	return s.st.DB.Queryx(q, args...)
 }
 
@@ -36,11 +88,14 @@ func (s *Service) Create(convSvc *conversations.Service, convID, senderID, text
 	if isDirect {
 		peer, err := convSvc.PeerInDirect(convID, senderID)
 		if err != nil { return 0, time.Time{}, nil, err }
-		var x int
-		if err := s.st.DB.QueryRowx(`SELECT 1 FROM contacts WHERE owner_id=$1 AND contact_id=$2`, senderID, peer).Scan(&x); err != nil {
-			if errors.Is(err, sql.ErrNoRows) { return 0, time.Time{}, nil, errors.New("peer not in contacts") }
-			return 0, time.Time{}, nil, err
-		}
+		// Blocking also removes the contacts, so a block by the sender is
+		// checked first to report it. A block by the peer reads as not being
+		// contacts, as it does when adding them.
+		var blocked, mutual bool
+		if err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM user_blocks WHERE blocker_id=$1 AND blocked_id=$2), `+contacts.MutualSQL, senderID, peer).
+			Scan(&blocked, &mutual); err != nil { return 0, time.Time{}, nil, err }
+		if blocked { return 0, time.Time{}, nil, ErrBlocked }
+		if !mutual { return 0, time.Time{}, nil, errors.New("peer not in contacts") }
 	}
 
 	createdAt := time.Now().UTC()
@@ -55,13 +110,25 @@ func (s *Service) Create(convSvc *conversations.Service, convID, senderID, text
 	return id, createdAt, expires, nil
 }
 
-func (s *Service) SoftDelete(id int64, userID string) error {
-	// Only allow sender to soft-delete their message (can be expanded to moderators)
-	res, err := s.st.DB.Exec(`UPDATE messages SET deleted_at=now() WHERE id=$1 AND sender_id=$2 AND deleted_at IS NULL`, id, userID)
-	if err != nil { return err }
-	a, _ := res.RowsAffected()
-	if a == 0 { return errors.New("not found or not allowed") }
-	return nil
+// SoftDelete hides a message. Senders may delete their own messages,
+// moderators and admins anyone's; deleted_by records who did it. It returns
+// the conversation so callers can notify its participants.
+func (s *Service) SoftDelete(convSvc *conversations.Service, id int64, userID, role string) (string, error) {
+	var convID, sender, kind string
+	err := s.st.DB.QueryRowx(`SELECT conversation_id, sender_id, kind FROM messages WHERE id=$1 AND deleted_at IS NULL`, id).Scan(&convID, &sender, &kind)
+	if errors.Is(err, sql.ErrNoRows) { return "", ErrNotFound }
+	if err != nil { return "", err }
+	// System messages are the group's membership history, not the sender's words.
+	if sender != userID || kind == "system" {
+		if err := convSvc.Authorize(convID, userID, role, conversations.ActionModerate); err != nil {
+			if errors.Is(err, conversations.ErrForbidden) { return "", ErrForbidden }
+			return "", err
+		}
+	}
+	res, err := s.st.DB.Exec(`UPDATE messages SET deleted_at=now(), deleted_by=$2 WHERE id=$1 AND deleted_at IS NULL`, id, userID)
+	if err != nil { return "", err }
+	if a, _ := res.RowsAffected(); a == 0 { return "", ErrNotFound }
+	return convID, nil
 }
 
 func StartPurger(db *sqlx.DB, every time.Duration) {
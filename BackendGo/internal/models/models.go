@@ -7,12 +7,20 @@ type User struct {
 	Email       string    `db:"email" json:"email"`
 	PasswordHash string   `db:"password_hash" json:"-"`
 	CreatedAt   time.Time `db:"created_at" json:"created_at"`
+	DisplayName *string   `db:"display_name" json:"display_name"`
+	AvatarURL   *string   `db:"avatar_url" json:"avatar_url"`
+	Bio         *string   `db:"bio" json:"bio"`
+	Timezone    *string   `db:"timezone" json:"timezone"`
+	DeletedAt   *time.Time `db:"deleted_at" json:"deleted_at,omitempty"` // set on tombstoned accounts
 }
 
 type Contact struct {
 	ID        int64     `db:"id" json:"id"`
 	OwnerID   string    `db:"owner_id" json:"owner_id"`
 	ContactID string    `db:"contact_id" json:"contact_id"`
+	Nickname  *string   `db:"nickname" json:"nickname"` // private to the owner
+	Labels    []string  `db:"-" json:"labels"`
+	Favorite  bool      `db:"favorite" json:"favorite"`
 	CreatedAt time.Time `db:"created_at" json:"created_at"`
 }
 
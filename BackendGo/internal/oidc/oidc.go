@@ -0,0 +1,215 @@
+package oidc
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+type Config struct {
+	Issuer       string
+	ClientID     string
+	ClientSecret string // empty for public clients; PKCE is always used
+	RedirectURL  string
+	Scopes       []string // "openid" is always requested
+}
+
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Provider is an OpenID Connect relying party for a single issuer.
+type Provider struct {
+	cfg    Config
+	client *http.Client
+	meta   metadata
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	keysFetched time.Time
+}
+
+// IDToken holds the verified claims we use from an ID token.
+type IDToken struct {
+	Issuer        string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Name          string
+}
+
+// Discover loads the issuer's metadata from /.well-known/openid-configuration.
+func Discover(cfg Config, client *http.Client) (*Provider, error) {
+	if client == nil { client = &http.Client{Timeout: 10 * time.Second} }
+	p := &Provider{cfg: cfg, client: client}
+	if err := p.getJSON(strings.TrimRight(cfg.Issuer, "/")+"/.well-known/openid-configuration", &p.meta); err != nil { return nil, fmt.Errorf("oidc discovery: %w", err) }
+	if p.meta.Issuer != cfg.Issuer { return nil, fmt.Errorf("oidc discovery: issuer mismatch %q", p.meta.Issuer) }
+	if p.meta.AuthorizationEndpoint == "" || p.meta.TokenEndpoint == "" || p.meta.JWKSURI == "" { return nil, errors.New("oidc discovery: incomplete metadata") }
+	return p, nil
+}
+
+func (p *Provider) Issuer() string { return p.cfg.Issuer }
+
+// NewPKCE returns a code verifier and its S256 challenge.
+func NewPKCE() (verifier, challenge string, err error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil { return "", "", err }
+	verifier = base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(verifier))
+	return verifier, base64.RawURLEncoding.EncodeToString(sum[:]), nil
+}
+
+// AuthCodeURL is where the browser is sent to sign in.
+func (p *Provider) AuthCodeURL(state, nonce, challenge string) string {
+	v := url.Values{}
+	v.Set("response_type", "code")
+	v.Set("client_id", p.cfg.ClientID)
+	v.Set("redirect_uri", p.cfg.RedirectURL)
+	v.Set("scope", strings.Join(append([]string{"openid"}, p.cfg.Scopes...), " "))
+	v.Set("state", state)
+	v.Set("nonce", nonce)
+	v.Set("code_challenge", challenge)
+	v.Set("code_challenge_method", "S256")
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") { sep = "&" }
+	return p.meta.AuthorizationEndpoint + sep + v.Encode()
+}
+
+// Exchange redeems an authorization code and returns the verified ID token.
+func (p *Provider) Exchange(code, verifier, nonce string) (*IDToken, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("code_verifier", verifier)
+	form.Set("client_id", p.cfg.ClientID)
+	req, err := http.NewRequest(http.MethodPost, p.meta.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil { return nil, err }
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if p.cfg.ClientSecret != "" { req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret)) }
+	resp, err := p.client.Do(req)
+	if err != nil { return nil, err }
+	defer resp.Body.Close()
+	var tr struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+		Desc    string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tr); err != nil { return nil, fmt.Errorf("oidc token response: %w", err) }
+	if resp.StatusCode != http.StatusOK || tr.Error != "" { return nil, fmt.Errorf("oidc token exchange failed: %s %s", tr.Error, tr.Desc) }
+	if tr.IDToken == "" { return nil, errors.New("oidc token response has no id_token") }
+	return p.VerifyIDToken(tr.IDToken, nonce)
+}
+
+type idClaims struct {
+	Nonce         string `json:"nonce"`
+	Email         string `json:"email"`
+	EmailVerified any    `json:"email_verified"` // some IdPs send "true"
+	Name          string `json:"name"`
+	jwt.RegisteredClaims
+}
+
+// VerifyIDToken checks signature, issuer, audience, expiry and nonce.
+func (p *Provider) VerifyIDToken(raw, nonce string) (*IDToken, error) {
+	var c idClaims
+	_, err := jwt.ParseWithClaims(raw, &c, p.keyFor,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "EdDSA"}),
+		jwt.WithIssuer(p.cfg.Issuer), jwt.WithAudience(p.cfg.ClientID), jwt.WithExpirationRequired(), jwt.WithLeeway(time.Minute))
+	if err != nil { return nil, fmt.Errorf("oidc id_token: %w", err) }
+	if c.Nonce != nonce { return nil, errors.New("oidc id_token: nonce mismatch") }
+	if c.Subject == "" { return nil, errors.New("oidc id_token: missing sub") }
+	verified := c.EmailVerified == true || c.EmailVerified == "true"
+	return &IDToken{Issuer: c.Issuer, Subject: c.Subject, Email: strings.ToLower(c.Email), EmailVerified: verified, Name: c.Name}, nil
+}
+
+func (p *Provider) keyFor(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+	p.mu.Lock(); defer p.mu.Unlock()
+	if k, ok := p.lookup(kid); ok { return k, nil }
+	// Unknown kid: the IdP may have rotated. Refetch, but at most every 30s.
+	if time.Since(p.keysFetched) > 30*time.Second {
+		if err := p.fetchKeys(); err != nil { return nil, err }
+		if k, ok := p.lookup(kid); ok { return k, nil }
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *Provider) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(p.keys) == 1 { for _, k := range p.keys { return k, true } }
+	k, ok := p.keys[kid]
+	return k, ok
+}
+
+type jwk struct {
+	Kty, Kid, Use, Crv string
+	N, E, X, Y         string
+}
+
+func (p *Provider) fetchKeys() error {
+	var set struct{ Keys []jwk `json:"keys"` }
+	if err := p.getJSON(p.meta.JWKSURI, &set); err != nil { return fmt.Errorf("oidc jwks: %w", err) }
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" { continue }
+		if pub, err := k.publicKey(); err == nil { keys[k.Kid] = pub }
+	}
+	p.keys, p.keysFetched = keys, time.Now()
+	return nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	dec := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := dec(k.N)
+		if err != nil { return nil, err }
+		e, err := dec(k.E)
+		if err != nil { return nil, err }
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256": curve = elliptic.P256()
+		case "P-384": curve = elliptic.P384()
+		default: return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := dec(k.X)
+		if err != nil { return nil, err }
+		y, err := dec(k.Y)
+		if err != nil { return nil, err }
+		return &ecdsa.PublicKey{Curve: curve, X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}, nil
+	case "OKP":
+		x, err := dec(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize { return nil, errors.New("unsupported OKP key") }
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func (p *Provider) getJSON(u string, v any) error {
+	resp, err := p.client.Get(u)
+	if err != nil { return err }
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK { return fmt.Errorf("GET %s: %s", u, resp.Status) }
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,92 @@
+package oidc
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// mockIssuer is a minimal IdP: discovery, JWKS and a token endpoint that
+// checks PKCE and returns an RS256 id_token for a fixed user.
+type mockIssuer struct {
+	*httptest.Server
+	key       *rsa.PrivateKey
+	challenge string // recorded from the authorize step
+	nonce     string
+	aud       string
+}
+
+func newMockIssuer(t *testing.T) *mockIssuer {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	m := &mockIssuer{key: key, aud: "chat-client"}
+	mux := http.NewServeMux()
+	m.Server = httptest.NewServer(mux)
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{"issuer": m.URL, "authorization_endpoint": m.URL + "/authorize", "token_endpoint": m.URL + "/token", "jwks_uri": m.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		b64 := base64.RawURLEncoding
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{"kty": "RSA", "kid": "k1", "use": "sig",
+			"n": b64.EncodeToString(key.N.Bytes()), "e": b64.EncodeToString(big.NewInt(int64(key.E)).Bytes())}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+		if r.Form.Get("code") != "good-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"id_token": m.sign(t, jwt.MapClaims{
+			"iss": m.URL, "aud": m.aud, "sub": "staff-42", "email": "Ann@Corp.example", "email_verified": true,
+			"nonce": m.nonce, "exp": time.Now().Add(time.Minute).Unix(),
+		})})
+	})
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockIssuer) sign(t *testing.T, c jwt.MapClaims) string {
+	tok := jwt.NewWithClaims(jwt.SigningMethodRS256, c)
+	tok.Header["kid"] = "k1"
+	s, err := tok.SignedString(m.key)
+	if err != nil { t.Fatal(err) }
+	return s
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	m := newMockIssuer(t)
+	p, err := Discover(Config{Issuer: m.URL, ClientID: "chat-client", RedirectURL: "http://app/cb", Scopes: []string{"email"}}, m.Client())
+	if err != nil { t.Fatal(err) }
+
+	verifier, challenge, _ := NewPKCE()
+	u, _ := url.Parse(p.AuthCodeURL("st", "n-1", challenge))
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" || q.Get("scope") != "openid email" || q.Get("state") != "st" { t.Fatalf("auth url %s", u) }
+	m.challenge, m.nonce = q.Get("code_challenge"), q.Get("nonce")
+
+	id, err := p.Exchange("good-code", verifier, "n-1")
+	if err != nil { t.Fatal(err) }
+	if id.Subject != "staff-42" || id.Email != "ann@corp.example" || !id.EmailVerified { t.Fatalf("id = %+v", id) }
+
+	if _, err := p.Exchange("good-code", "wrong-verifier", "n-1"); err == nil { t.Fatal("bad PKCE verifier accepted") }
+	if _, err := p.Exchange("good-code", verifier, "other-nonce"); err == nil { t.Fatal("nonce mismatch accepted") }
+}
+
+func TestVerifyIDTokenRejectsWrongAudience(t *testing.T) {
+	m := newMockIssuer(t)
+	p, err := Discover(Config{Issuer: m.URL, ClientID: "chat-client"}, m.Client())
+	if err != nil { t.Fatal(err) }
+	tok := m.sign(t, jwt.MapClaims{"iss": m.URL, "aud": "someone-else", "sub": "x", "nonce": "n", "exp": time.Now().Add(time.Minute).Unix()})
+	if _, err := p.VerifyIDToken(tok, "n"); err == nil { t.Fatal("foreign audience accepted") }
+}
@@ -0,0 +1,50 @@
+package presence
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go-chat-backend/internal/auth"
+)
+
+// HandleGet serves GET /api/presence?user_ids=a,b,c .
+func HandleGet(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	raw := r.URL.Query().Get("user_ids")
+	if raw == "" { http.Error(w, "user_ids is required", http.StatusBadRequest); return nil }
+	entries, err := s.Get(u.UserID, strings.Split(raw, ","))
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(entries)
+}
+
+type statusReq struct {
+	Emoji             string     `json:"emoji"`
+	Text              string     `json:"text"`
+	ClearsAt          *time.Time `json:"clears_at"`
+	ClearAfterSeconds int64      `json:"clear_after_seconds"` // alternative to clears_at
+}
+
+// HandleStatus serves GET, PUT and DELETE /api/users/me/status.
+func HandleStatus(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	switch r.Method {
+	case http.MethodGet:
+		st, err := s.GetStatus(u.UserID)
+		if err != nil { return err }
+		return json.NewEncoder(w).Encode(map[string]any{"status": st})
+	case http.MethodDelete:
+		if err := s.ClearStatus(u.UserID); err != nil { return err }
+		w.WriteHeader(http.StatusNoContent)
+		return nil
+	}
+	var req statusReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if req.ClearsAt == nil && req.ClearAfterSeconds > 0 { t := time.Now().Add(time.Duration(req.ClearAfterSeconds) * time.Second); req.ClearsAt = &t }
+	st, err := s.SetStatus(u.UserID, Status{Emoji: req.Emoji, Text: req.Text, ClearsAt: req.ClearsAt})
+	if errors.Is(err, ErrInvalidStatus) { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(map[string]any{"status": st})
+}
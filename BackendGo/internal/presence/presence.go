@@ -0,0 +1,98 @@
+package presence
+
+import (
+	"log"
+	"regexp"
+	"time"
+
+	"go-chat-backend/internal/contacts"
+	"go-chat-backend/internal/privacy"
+	"go-chat-backend/internal/store"
+)
+
+// maxQueryIDs caps GET /api/presence?user_ids= .
+const maxQueryIDs = 100
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// Tracker is the live connection state; *ws.Hub implements it.
+type Tracker interface {
+	Presence(userID string) string
+	SendToUser(userID string, payload any)
+}
+
+// Service combines live presence from the hub with the persisted last-seen
+// time, and decides who may see whom: yourself, your contacts, and people
+// you share a conversation with.
+type Service struct {
+	st  *store.Store
+	hub Tracker
+}
+
+func NewService(st *store.Store, hub Tracker) *Service { return &Service{st: st, hub: hub} }
+
+type Entry struct {
+	UserID       string     `json:"user_id"`
+	Status       string     `json:"status"`
+	LastSeenAt   *time.Time `json:"last_seen_at"`
+	CustomStatus *Status    `json:"custom_status"`
+}
+
+// Changed records a presence transition and pushes it to everyone who has
+// userID as a contact, leaving out last_seen_at where userID's privacy
+// settings hide it. Register it with ws.Hub.OnPresence.
+func (s *Service) Changed(userID, status string) {
+	var seen time.Time
+	if err := s.st.DB.QueryRowx(`UPDATE users SET last_seen_at=now() WHERE id=$1 RETURNING last_seen_at`, userID).Scan(&seen); err != nil {
+		log.Printf("presence %s: %v", userID, err); return
+	}
+	var watchers []struct {
+		ID       string `db:"owner_id"`
+		SeesSeen bool   `db:"sees_seen"`
+	}
+	if err := s.st.DB.Select(&watchers, `SELECT owner_id, `+privacy.VisibleSQL(privacy.LastSeen, "owner_id", "$1::uuid")+` AS sees_seen
+		FROM contacts WHERE contact_id=$1 AND NOT `+blockedWith("owner_id"), userID); err != nil {
+		log.Printf("presence watchers %s: %v", userID, err); return
+	}
+	ev := map[string]any{"type": "presence", "user_id": userID, "status": status, "last_seen_at": seen}
+	hidden := map[string]any{"type": "presence", "user_id": userID, "status": status, "last_seen_at": nil}
+	for _, w := range watchers {
+		if w.SeesSeen { s.hub.SendToUser(w.ID, ev) } else { s.hub.SendToUser(w.ID, hidden) }
+	}
+}
+
+// blockedWith is the SQL condition "a block exists between $1 and col".
+func blockedWith(col string) string { return contacts.BlockedBetween("$1", col) }
+
+// Get returns presence for the ids viewerID may see; others are left out.
+// last_seen_at is null where the user's privacy settings hide it.
+func (s *Service) Get(viewerID string, ids []string) ([]Entry, error) {
+	valid := make([]string, 0, len(ids))
+	for _, id := range ids {
+		if uuidRe.MatchString(id) { valid = append(valid, id) }
+		if len(valid) == maxQueryIDs { break }
+	}
+	out := []Entry{}
+	if len(valid) == 0 { return out, nil }
+	var rows []struct {
+		ID         string     `db:"id"`
+		LastSeenAt *time.Time `db:"last_seen_at"`
+		Emoji      *string    `db:"emoji"`
+		Text       *string    `db:"text"`
+		ClearsAt   *time.Time `db:"clears_at"`
+		UpdatedAt  *time.Time `db:"updated_at"`
+	}
+	err := s.st.DB.Select(&rows, `SELECT u.id, CASE WHEN `+privacy.VisibleSQL(privacy.LastSeen, "$1::uuid", "u.id")+` THEN u.last_seen_at END AS last_seen_at, st.emoji, st.text, st.clears_at, st.updated_at FROM users u
+		LEFT JOIN user_status st ON st.user_id=u.id AND (st.clears_at IS NULL OR st.clears_at > now())
+		WHERE u.id = ANY($2::uuid[]) AND u.deleted_at IS NULL AND NOT `+blockedWith("u.id")+` AND (u.id = $1
+			OR EXISTS(SELECT 1 FROM contacts c WHERE c.owner_id=$1 AND c.contact_id=u.id)
+			OR EXISTS(SELECT 1 FROM conversation_participants a JOIN conversation_participants b ON a.conversation_id=b.conversation_id
+				WHERE a.user_id=$1 AND b.user_id=u.id))`, viewerID, valid)
+	if err != nil { return nil, err }
+	for _, r := range rows {
+		e := Entry{UserID: r.ID, Status: s.hub.Presence(r.ID), LastSeenAt: r.LastSeenAt}
+		if r.UpdatedAt != nil { e.CustomStatus = &Status{Emoji: *r.Emoji, Text: *r.Text, ClearsAt: r.ClearsAt, UpdatedAt: *r.UpdatedAt} }
+		out = append(out, e)
+	}
+	return out, nil
+}
@@ -0,0 +1,91 @@
+package presence
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	maxStatusText  = 100
+	maxStatusEmoji = 8 // runes; flags and skin tones take several
+)
+
+var ErrInvalidStatus = errors.New("status needs an emoji or text (max 100 characters) and clears_at in the future")
+
+// Status is a user's custom status, e.g. 📅 "In a meeting" until 15:00.
+type Status struct {
+	Emoji     string     `db:"emoji" json:"emoji"`
+	Text      string     `db:"text" json:"text"`
+	ClearsAt  *time.Time `db:"clears_at" json:"clears_at"`
+	UpdatedAt time.Time  `db:"updated_at" json:"updated_at"`
+}
+
+// Normalize trims st and checks it against now.
+func (st *Status) Normalize(now time.Time) error {
+	st.Emoji, st.Text = strings.TrimSpace(st.Emoji), strings.TrimSpace(st.Text)
+	if st.Emoji == "" && st.Text == "" { return ErrInvalidStatus }
+	if utf8.RuneCountInString(st.Text) > maxStatusText || utf8.RuneCountInString(st.Emoji) > maxStatusEmoji { return ErrInvalidStatus }
+	if strings.IndexFunc(st.Emoji+st.Text, unicode.IsControl) >= 0 { return ErrInvalidStatus }
+	if st.ClearsAt != nil && !st.ClearsAt.After(now) { return ErrInvalidStatus }
+	return nil
+}
+
+// GetStatus returns userID's status, or nil when none is set.
+func (s *Service) GetStatus(userID string) (*Status, error) {
+	st := &Status{}
+	err := s.st.DB.Get(st, `SELECT emoji, text, clears_at, updated_at FROM user_status WHERE user_id=$1 AND (clears_at IS NULL OR clears_at > now())`, userID)
+	if errors.Is(err, sql.ErrNoRows) { return nil, nil }
+	if err != nil { return nil, err }
+	return st, nil
+}
+
+// SetStatus replaces userID's status and tells everyone who can see it.
+func (s *Service) SetStatus(userID string, st Status) (*Status, error) {
+	if err := st.Normalize(time.Now()); err != nil { return nil, err }
+	if err := s.st.DB.QueryRowx(`INSERT INTO user_status(user_id, emoji, text, clears_at, updated_at) VALUES($1,$2,$3,$4,now())
+		ON CONFLICT(user_id) DO UPDATE SET emoji=EXCLUDED.emoji, text=EXCLUDED.text, clears_at=EXCLUDED.clears_at, updated_at=EXCLUDED.updated_at
+		RETURNING updated_at`, userID, st.Emoji, st.Text, st.ClearsAt).Scan(&st.UpdatedAt); err != nil {
+		return nil, err
+	}
+	s.notifyStatus(userID, &st)
+	return &st, nil
+}
+
+// ClearStatus removes userID's status.
+func (s *Service) ClearStatus(userID string) error {
+	res, err := s.st.DB.Exec(`DELETE FROM user_status WHERE user_id=$1`, userID)
+	if err != nil { return err }
+	if n, _ := res.RowsAffected(); n > 0 { s.notifyStatus(userID, nil) }
+	return nil
+}
+
+// notifyStatus pushes a status change (nil = cleared) to userID's contacts
+// and everyone they share a conversation with, each once.
+func (s *Service) notifyStatus(userID string, st *Status) {
+	var audience []string
+	if err := s.st.DB.Select(&audience, `SELECT id FROM (SELECT owner_id AS id FROM contacts WHERE contact_id=$1
+		UNION SELECT b.user_id FROM conversation_participants a JOIN conversation_participants b ON a.conversation_id=b.conversation_id
+			WHERE a.user_id=$1 AND b.user_id<>$1) aud WHERE NOT `+blockedWith("aud.id"), userID); err != nil {
+		log.Printf("status audience %s: %v", userID, err); return
+	}
+	ev := map[string]any{"type": "status", "user_id": userID, "status": st}
+	for _, id := range append(audience, userID) { s.hub.SendToUser(id, ev) } // the user's other devices too
+}
+
+// StartStatusClearer removes expired statuses every interval and announces it.
+func StartStatusClearer(s *Service, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		var cleared []string
+		if err := s.st.DB.Select(&cleared, `DELETE FROM user_status WHERE clears_at <= now() RETURNING user_id`); err != nil {
+			log.Printf("status clearer: %v", err); continue
+		}
+		for _, id := range cleared { s.notifyStatus(id, nil) }
+	}
+}
@@ -0,0 +1,24 @@
+package presence
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStatusNormalize(t *testing.T) {
+	now := time.Now()
+	later, earlier := now.Add(time.Hour), now.Add(-time.Minute)
+	ok := Status{Emoji: " 📅 ", Text: " In a meeting ", ClearsAt: &later}
+	if err := ok.Normalize(now); err != nil || ok.Text != "In a meeting" || ok.Emoji != "📅" { t.Fatalf("got %+v, %v", ok, err) }
+	bad := []Status{
+		{},
+		{Text: strings.Repeat("x", 101)},
+		{Emoji: "📅", ClearsAt: &earlier},
+		{Text: "line\nbreak"},
+		{Emoji: strings.Repeat("😀", 9)},
+	}
+	for i, st := range bad {
+		if err := st.Normalize(now); err != ErrInvalidStatus { t.Errorf("case %d: got %v", i, err) }
+	}
+}
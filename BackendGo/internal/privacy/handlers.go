@@ -0,0 +1,25 @@
+package privacy
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"go-chat-backend/internal/auth"
+)
+
+// HandleSettings serves GET and PATCH /api/users/me/privacy.
+func HandleSettings(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	if r.Method == http.MethodGet {
+		st, err := s.Get(u.UserID)
+		if err != nil { return err }
+		return json.NewEncoder(w).Encode(st)
+	}
+	var req Update
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	st, err := s.Update(u.UserID, req)
+	if errors.Is(err, ErrInvalidSetting) { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(st)
+}
@@ -0,0 +1,110 @@
+package privacy
+
+import (
+	"database/sql"
+	"errors"
+
+	"go-chat-backend/internal/store"
+)
+
+// Audiences.
+const (
+	Everyone           = "everyone"
+	ContactsOfContacts = "contacts_of_contacts" // contact requests only
+	Contacts           = "contacts"
+	Nobody             = "nobody"
+)
+
+// Fields whose visibility can be restricted.
+const (
+	LastSeen     = "last_seen"
+	ProfilePhoto = "profile_photo"
+)
+
+var ErrInvalidSetting = errors.New("contact_requests must be everyone, contacts_of_contacts or nobody; last_seen and profile_photo everyone, contacts or nobody")
+
+type Settings struct {
+	ContactRequests string `db:"contact_requests" json:"contact_requests"` // who may send me contact requests
+	LastSeen        string `db:"last_seen" json:"last_seen"`               // who sees when I was last online
+	ProfilePhoto    string `db:"profile_photo" json:"profile_photo"`       // who sees my avatar
+}
+
+// Defaults apply to users who never changed their settings.
+var Defaults = Settings{ContactRequests: Everyone, LastSeen: Contacts, ProfilePhoto: Everyone}
+
+// Update is a partial change; nil fields are kept.
+type Update struct {
+	ContactRequests *string `json:"contact_requests"`
+	LastSeen        *string `json:"last_seen"`
+	ProfilePhoto    *string `json:"profile_photo"`
+}
+
+// Apply returns cur with u applied, or ErrInvalidSetting.
+func (u Update) Apply(cur Settings) (Settings, error) {
+	if v := u.ContactRequests; v != nil {
+		if *v != Everyone && *v != ContactsOfContacts && *v != Nobody { return cur, ErrInvalidSetting }
+		cur.ContactRequests = *v
+	}
+	for _, f := range []struct{ in *string; out *string }{{u.LastSeen, &cur.LastSeen}, {u.ProfilePhoto, &cur.ProfilePhoto}} {
+		if f.in == nil { continue }
+		if *f.in != Everyone && *f.in != Contacts && *f.in != Nobody { return cur, ErrInvalidSetting }
+		*f.out = *f.in
+	}
+	return cur, nil
+}
+
+// VisibleSQL is a boolean SQL expression: may the user in column/parameter
+// viewer see field of the user in owner? Users always see themselves; a NULL
+// viewer (e.g. a broadcast to many people) only passes "everyone".
+func VisibleSQL(field, viewer, owner string) string {
+	def := map[string]string{LastSeen: Defaults.LastSeen, ProfilePhoto: Defaults.ProfilePhoto}[field]
+	if def == "" { panic("privacy: unknown field " + field) }
+	return `COALESCE(` + owner + ` = ` + viewer + ` OR CASE COALESCE((SELECT pv.` + field + ` FROM user_privacy pv WHERE pv.user_id=` + owner + `), '` + def + `')
+		WHEN 'everyone' THEN true
+		WHEN 'contacts' THEN EXISTS(SELECT 1 FROM contacts pc WHERE pc.owner_id=` + owner + ` AND pc.contact_id=` + viewer + `)
+		ELSE false END, false)`
+}
+
+type Service struct{ st *store.Store }
+
+func NewService(st *store.Store) *Service { return &Service{st: st} }
+
+func (s *Service) Get(userID string) (Settings, error) {
+	st := Defaults
+	err := s.st.DB.Get(&st, `SELECT contact_requests, last_seen, profile_photo FROM user_privacy WHERE user_id=$1`, userID)
+	if errors.Is(err, sql.ErrNoRows) { return Defaults, nil }
+	return st, err
+}
+
+func (s *Service) Update(userID string, u Update) (Settings, error) {
+	cur, err := s.Get(userID)
+	if err != nil { return cur, err }
+	next, err := u.Apply(cur)
+	if err != nil { return cur, err }
+	_, err = s.st.DB.Exec(`INSERT INTO user_privacy(user_id, contact_requests, last_seen, profile_photo, updated_at) VALUES($1,$2,$3,$4,now())
+		ON CONFLICT(user_id) DO UPDATE SET contact_requests=EXCLUDED.contact_requests, last_seen=EXCLUDED.last_seen,
+			profile_photo=EXCLUDED.profile_photo, updated_at=EXCLUDED.updated_at`, userID, next.ContactRequests, next.LastSeen, next.ProfilePhoto)
+	return next, err
+}
+
+// CanRequest reports whether requester may send recipient a contact request.
+func (s *Service) CanRequest(requester, recipient string) (bool, error) {
+	st, err := s.Get(recipient)
+	if err != nil { return false, err }
+	switch st.ContactRequests {
+	case Everyone: return true, nil
+	case ContactsOfContacts:
+		var ok bool
+		err := s.st.DB.QueryRowx(`SELECT EXISTS(SELECT 1 FROM contacts a JOIN contacts b ON a.contact_id=b.contact_id
+			WHERE a.owner_id=$1 AND b.owner_id=$2)`, recipient, requester).Scan(&ok)
+		return ok, err
+	}
+	return false, nil
+}
+
+// CanSee reports whether viewer may see owner's field.
+func (s *Service) CanSee(viewer, owner, field string) (bool, error) {
+	var ok bool
+	err := s.st.DB.QueryRowx(`SELECT `+VisibleSQL(field, "$1::uuid", "$2::uuid"), viewer, owner).Scan(&ok)
+	return ok, err
+}
@@ -0,0 +1,21 @@
+package privacy
+
+import "testing"
+
+func str(s string) *string { return &s }
+
+func TestUpdateApply(t *testing.T) {
+	got, err := Update{ContactRequests: str(Nobody), ProfilePhoto: str(Contacts)}.Apply(Defaults)
+	want := Settings{ContactRequests: Nobody, LastSeen: Defaults.LastSeen, ProfilePhoto: Contacts}
+	if err != nil || got != want { t.Errorf("got %+v, %v", got, err) }
+
+	bad := []Update{{ContactRequests: str(Contacts)}, {LastSeen: str(ContactsOfContacts)}, {ProfilePhoto: str("friends")}}
+	for i, u := range bad {
+		if _, err := u.Apply(Defaults); err != ErrInvalidSetting { t.Errorf("case %d: %v", i, err) }
+	}
+}
+
+func TestVisibleSQLUnknownField(t *testing.T) {
+	defer func() { if recover() == nil { t.Error("unknown field did not panic") } }()
+	VisibleSQL("email", "$1", "u.id")
+}
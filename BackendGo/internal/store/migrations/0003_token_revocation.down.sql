@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_revoked_tokens_expires;
+DROP TABLE IF EXISTS revoked_tokens;
+ALTER TABLE users DROP COLUMN IF EXISTS tokens_valid_after;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN tokens_valid_after TIMESTAMPTZ NULL;
+
+CREATE TABLE revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_revoked_tokens_expires ON revoked_tokens(expires_at);
@@ -0,0 +1,17 @@
+CREATE TABLE sessions (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    device_name TEXT NOT NULL DEFAULT '',
+    user_agent TEXT NOT NULL DEFAULT '',
+    ip TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_seen_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    revoked_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_sessions_user ON sessions(user_id);
+
+-- Refresh tokens issued before sessions existed cannot be attributed to one; drop them.
+DELETE FROM refresh_tokens;
+ALTER TABLE refresh_tokens ADD COLUMN session_id UUID NOT NULL REFERENCES sessions(id) ON DELETE CASCADE;
+CREATE INDEX idx_refresh_tokens_session ON refresh_tokens(session_id);
@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_auth_failures_ip;
+DROP INDEX IF EXISTS idx_auth_failures_email;
+DROP TABLE IF EXISTS auth_failures;
@@ -0,0 +1,13 @@
+-- Audit log of failed sign-in attempts; uncleared recent rows drive lockout.
+CREATE TABLE auth_failures (
+    id BIGSERIAL PRIMARY KEY,
+    email TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    user_id UUID NULL REFERENCES users(id) ON DELETE SET NULL,
+    reason TEXT NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    cleared_at TIMESTAMPTZ NULL
+);
+
+CREATE INDEX idx_auth_failures_email ON auth_failures(email, created_at);
+CREATE INDEX idx_auth_failures_ip ON auth_failures(ip, created_at);
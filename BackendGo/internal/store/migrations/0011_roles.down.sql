@@ -0,0 +1,2 @@
+ALTER TABLE messages DROP COLUMN IF EXISTS deleted_by;
+ALTER TABLE users DROP COLUMN IF EXISTS role;
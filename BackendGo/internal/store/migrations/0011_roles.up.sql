@@ -0,0 +1,2 @@
+ALTER TABLE users ADD COLUMN role TEXT NOT NULL DEFAULT 'user' CHECK (role IN ('user','moderator','admin'));
+ALTER TABLE messages ADD COLUMN deleted_by UUID NULL REFERENCES users(id) ON DELETE SET NULL;
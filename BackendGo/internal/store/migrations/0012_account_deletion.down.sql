@@ -0,0 +1,7 @@
+ALTER TABLE messages DROP CONSTRAINT messages_sender_id_fkey,
+    ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE CASCADE;
+ALTER TABLE conversation_participants DROP CONSTRAINT conversation_participants_user_id_fkey,
+    ADD CONSTRAINT conversation_participants_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE CASCADE;
+
+DROP INDEX IF EXISTS idx_users_deletion_due;
+ALTER TABLE users DROP COLUMN IF EXISTS deletion_mode, DROP COLUMN IF EXISTS deletion_scheduled_for, DROP COLUMN IF EXISTS deleted_at;
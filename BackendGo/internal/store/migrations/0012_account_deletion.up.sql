@@ -0,0 +1,13 @@
+-- Deleted accounts stay as tombstones so the other side of a conversation
+-- keeps its history; a hard DELETE on users must no longer cascade into it.
+ALTER TABLE users
+    ADD COLUMN deleted_at TIMESTAMPTZ NULL,
+    ADD COLUMN deletion_scheduled_for TIMESTAMPTZ NULL,
+    ADD COLUMN deletion_mode TEXT NULL CHECK (deletion_mode IN ('anonymize','remove'));
+
+CREATE INDEX idx_users_deletion_due ON users(deletion_scheduled_for) WHERE deletion_scheduled_for IS NOT NULL;
+
+ALTER TABLE conversation_participants DROP CONSTRAINT conversation_participants_user_id_fkey,
+    ADD CONSTRAINT conversation_participants_user_id_fkey FOREIGN KEY (user_id) REFERENCES users(id) ON DELETE RESTRICT;
+ALTER TABLE messages DROP CONSTRAINT messages_sender_id_fkey,
+    ADD CONSTRAINT messages_sender_id_fkey FOREIGN KEY (sender_id) REFERENCES users(id) ON DELETE RESTRICT;
@@ -0,0 +1,15 @@
+CREATE TABLE data_exports (
+    id UUID PRIMARY KEY DEFAULT gen_random_uuid(),
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','ready','failed')),
+    token_hash TEXT NOT NULL UNIQUE,
+    file_path TEXT NULL,
+    size_bytes BIGINT NULL,
+    error TEXT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    completed_at TIMESTAMPTZ NULL,
+    expires_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX idx_data_exports_user ON data_exports(user_id, created_at DESC);
+CREATE INDEX idx_data_exports_expires ON data_exports(expires_at);
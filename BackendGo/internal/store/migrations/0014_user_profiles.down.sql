@@ -0,0 +1 @@
+ALTER TABLE users DROP COLUMN IF EXISTS timezone, DROP COLUMN IF EXISTS bio, DROP COLUMN IF EXISTS avatar_url, DROP COLUMN IF EXISTS display_name;
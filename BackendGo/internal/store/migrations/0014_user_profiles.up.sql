@@ -0,0 +1,5 @@
+ALTER TABLE users
+    ADD COLUMN display_name TEXT NULL CHECK (char_length(display_name) <= 64),
+    ADD COLUMN avatar_url TEXT NULL CHECK (char_length(avatar_url) <= 1024),
+    ADD COLUMN bio TEXT NULL CHECK (char_length(bio) <= 500),
+    ADD COLUMN timezone TEXT NULL;
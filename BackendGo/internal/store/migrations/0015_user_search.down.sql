@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_users_display_name_trgm;
+ALTER TABLE users DROP COLUMN IF EXISTS discoverable;
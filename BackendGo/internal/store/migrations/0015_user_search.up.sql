@@ -0,0 +1,6 @@
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- Opt-in: nobody is listed in the directory until they choose to be.
+ALTER TABLE users ADD COLUMN discoverable BOOLEAN NOT NULL DEFAULT false;
+
+CREATE INDEX idx_users_display_name_trgm ON users USING gin (lower(display_name) gin_trgm_ops);
@@ -0,0 +1,9 @@
+CREATE TABLE user_status (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    emoji TEXT NOT NULL DEFAULT '',
+    text TEXT NOT NULL DEFAULT '' CHECK (char_length(text) <= 100),
+    clears_at TIMESTAMPTZ NULL,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_user_status_clears ON user_status(clears_at) WHERE clears_at IS NOT NULL;
@@ -0,0 +1,4 @@
+INSERT INTO contacts(owner_id, contact_id, created_at)
+    SELECT requester_id, recipient_id, created_at FROM contact_requests WHERE status = 'pending'
+    ON CONFLICT DO NOTHING;
+DROP TABLE IF EXISTS contact_requests;
@@ -0,0 +1,19 @@
+CREATE TABLE contact_requests (
+    id BIGSERIAL PRIMARY KEY,
+    requester_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    recipient_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    status TEXT NOT NULL DEFAULT 'pending' CHECK (status IN ('pending','accepted','declined','cancelled')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    responded_at TIMESTAMPTZ NULL,
+    CHECK (requester_id <> recipient_id)
+);
+
+CREATE UNIQUE INDEX idx_contact_requests_pending ON contact_requests(requester_id, recipient_id) WHERE status = 'pending';
+CREATE INDEX idx_contact_requests_recipient ON contact_requests(recipient_id, status);
+
+-- One-sided adds become pending requests; contacts now always come in pairs.
+INSERT INTO contact_requests(requester_id, recipient_id, created_at)
+    SELECT c.owner_id, c.contact_id, c.created_at FROM contacts c
+    WHERE NOT EXISTS (SELECT 1 FROM contacts r WHERE r.owner_id = c.contact_id AND r.contact_id = c.owner_id);
+DELETE FROM contacts c
+    WHERE NOT EXISTS (SELECT 1 FROM contacts r WHERE r.owner_id = c.contact_id AND r.contact_id = c.owner_id);
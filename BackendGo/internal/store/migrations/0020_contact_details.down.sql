@@ -0,0 +1 @@
+ALTER TABLE contacts DROP COLUMN IF EXISTS favorite, DROP COLUMN IF EXISTS labels, DROP COLUMN IF EXISTS nickname;
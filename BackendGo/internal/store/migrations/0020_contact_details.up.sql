@@ -0,0 +1,4 @@
+ALTER TABLE contacts
+    ADD COLUMN nickname TEXT NULL CHECK (char_length(nickname) <= 64),
+    ADD COLUMN labels TEXT[] NOT NULL DEFAULT '{}',
+    ADD COLUMN favorite BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,8 @@
+CREATE TABLE contact_invites (
+    inviter_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    email TEXT NOT NULL,
+    sent_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    PRIMARY KEY (inviter_id, email)
+);
+
+CREATE INDEX idx_contact_invites_sent ON contact_invites(inviter_id, sent_at);
@@ -0,0 +1,8 @@
+-- Missing rows mean the defaults in internal/privacy.
+CREATE TABLE user_privacy (
+    user_id UUID PRIMARY KEY REFERENCES users(id) ON DELETE CASCADE,
+    contact_requests TEXT NOT NULL DEFAULT 'everyone' CHECK (contact_requests IN ('everyone','contacts_of_contacts','nobody')),
+    last_seen TEXT NOT NULL DEFAULT 'contacts' CHECK (last_seen IN ('everyone','contacts','nobody')),
+    profile_photo TEXT NOT NULL DEFAULT 'everyone' CHECK (profile_photo IN ('everyone','contacts','nobody')),
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
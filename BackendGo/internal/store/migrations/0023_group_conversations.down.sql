@@ -0,0 +1,8 @@
+DELETE FROM conversations WHERE type='group';
+DELETE FROM messages WHERE kind='system';
+ALTER TABLE messages DROP COLUMN meta, DROP COLUMN kind;
+DROP INDEX IF EXISTS idx_conversation_participants_owner;
+ALTER TABLE conversation_participants DROP COLUMN joined_at, DROP COLUMN role;
+ALTER TABLE conversations DROP CONSTRAINT conversations_group_title, DROP COLUMN title,
+    DROP CONSTRAINT conversations_type_check,
+    ADD CONSTRAINT conversations_type_check CHECK (type IN ('direct','public'));
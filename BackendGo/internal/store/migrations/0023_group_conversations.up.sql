@@ -0,0 +1,17 @@
+ALTER TABLE conversations DROP CONSTRAINT conversations_type_check,
+    ADD CONSTRAINT conversations_type_check CHECK (type IN ('direct','public','group')),
+    ADD COLUMN title TEXT NULL,
+    ADD CONSTRAINT conversations_group_title CHECK (type <> 'group' OR title IS NOT NULL);
+
+ALTER TABLE conversation_participants
+    ADD COLUMN role TEXT NOT NULL DEFAULT 'member' CHECK (role IN ('owner','admin','member')),
+    ADD COLUMN joined_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- One owner per group.
+CREATE UNIQUE INDEX idx_conversation_participants_owner ON conversation_participants(conversation_id) WHERE role='owner';
+
+-- System messages record membership changes; sender_id is the member who
+-- made the change and meta holds the event for clients to render.
+ALTER TABLE messages
+    ADD COLUMN kind TEXT NOT NULL DEFAULT 'text' CHECK (kind IN ('text','system')),
+    ADD COLUMN meta JSONB NULL;
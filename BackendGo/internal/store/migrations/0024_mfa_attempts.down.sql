@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS idx_auth_failures_token;
+ALTER TABLE auth_failures DROP COLUMN IF EXISTS token_id;
@@ -0,0 +1,5 @@
+-- Wrong second-factor codes name the mfa token they were tried with, so the
+-- per-token attempt limit holds across restarts and instances.
+ALTER TABLE auth_failures ADD COLUMN token_id TEXT NULL;
+
+CREATE INDEX idx_auth_failures_token ON auth_failures(token_id) WHERE token_id IS NOT NULL;
@@ -1,6 +1,16 @@
 package store
 
-import "github.com/jmoiron/sqlx"
+import (
+	"regexp"
+
+	"github.com/jmoiron/sqlx"
+)
 
 type Store struct{ DB *sqlx.DB }
-func New(db *sqlx.DB) *Store { return &Store{DB: db} }
\ No newline at end of file
+func New(db *sqlx.DB) *Store { return &Store{DB: db} }
+
+var uuidRe = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// IsUUID reports whether id can be a row id; check ids from requests with
+// it so a malformed one is "not found" rather than a failed ::uuid cast.
+func IsUUID(id string) bool { return uuidRe.MatchString(id) }
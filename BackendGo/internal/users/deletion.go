@@ -0,0 +1,109 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go-chat-backend/internal/mail"
+)
+
+// Deletion modes: what happens to the messages a deleted user sent.
+const (
+	ModeAnonymize = "anonymize" // keep them, attributed to a tombstone
+	ModeRemove    = "remove"    // delete them from every conversation
+)
+
+var (
+	ErrInvalidMode  = errors.New("mode must be anonymize or remove")
+	ErrNotScheduled = errors.New("no deletion scheduled")
+)
+
+// ScheduleDeletion marks the account for deletion after the grace period and
+// mails the user. Logging in again before then cancels it.
+func (s *Service) ScheduleDeletion(userID, mode string) (time.Time, error) {
+	if mode != ModeAnonymize && mode != ModeRemove { return time.Time{}, ErrInvalidMode }
+	due := time.Now().UTC().Add(s.grace)
+	var email string
+	err := s.st.DB.QueryRowx(`UPDATE users SET deletion_scheduled_for=$2, deletion_mode=$3 WHERE id=$1 AND deleted_at IS NULL RETURNING email`,
+		userID, due, mode).Scan(&email)
+	if err != nil { return time.Time{}, err }
+	msg := mail.Message{To: email, Subject: "Your Go Chat account will be deleted", Body: fmt.Sprintf(
+		"We received a request to delete your Go Chat account.\n\nIt will be deleted on %s. Until then, simply sign in again to cancel.\n",
+		due.Format("2 January 2006 15:04 MST"))}
+	go func() { if err := s.mailer.Send(msg); err != nil { log.Printf("deletion notice mail: %v", err) } }()
+	return due, nil
+}
+
+// Finalize turns a user whose grace period has passed into a tombstone. The
+// row stays so conversations keep their other participants' history; every
+// credential, contact and personal detail goes. Conversations left without
+// any live participant are dropped entirely.
+func (s *Service) Finalize(userID string) error {
+	tx, err := s.st.DB.Beginx()
+	if err != nil { return err }
+	defer tx.Rollback()
+	var mode string
+	err = tx.QueryRowx(`SELECT deletion_mode FROM users WHERE id=$1 AND deleted_at IS NULL AND deletion_scheduled_for <= now() FOR UPDATE`, userID).Scan(&mode)
+	if errors.Is(err, sql.ErrNoRows) { return ErrNotScheduled }
+	if err != nil { return err }
+
+	stmts := []string{
+		`DELETE FROM contacts WHERE owner_id=$1 OR contact_id=$1`,
+		`DELETE FROM sessions WHERE user_id=$1`,
+		`DELETE FROM refresh_tokens WHERE user_id=$1`,
+		`DELETE FROM personal_access_tokens WHERE user_id=$1`,
+		`DELETE FROM user_mfa WHERE user_id=$1`,
+		`DELETE FROM mfa_recovery_codes WHERE user_id=$1`,
+		`DELETE FROM revoked_tokens WHERE user_id=$1`, // tokens_valid_after below rejects them all
+		`DELETE FROM auth_failures WHERE user_id=$1 OR email=(SELECT email FROM users WHERE id=$1)`,
+		`DELETE FROM user_identities WHERE user_id=$1`,
+		`DELETE FROM password_resets WHERE user_id=$1`,
+		`DELETE FROM email_verifications WHERE user_id=$1`,
+		`DELETE FROM user_status WHERE user_id=$1`,
+		`DELETE FROM user_privacy WHERE user_id=$1`,
+		`DELETE FROM user_blocks WHERE blocker_id=$1 OR blocked_id=$1`,
+		`DELETE FROM contact_requests WHERE requester_id=$1 OR recipient_id=$1`,
+		`DELETE FROM contact_invites WHERE inviter_id=$1`,
+		`UPDATE data_exports SET expires_at=now() WHERE user_id=$1`, // files go with the next export purge
+		// Groups the user owns pass to their longest-standing live admin, or member.
+		`UPDATE conversation_participants SET role='member' WHERE user_id=$1 AND role='owner'`,
+		`UPDATE conversation_participants p SET role='owner' FROM (
+			SELECT DISTINCT ON (m.conversation_id) m.conversation_id, m.user_id FROM conversation_participants m
+			JOIN users u ON u.id=m.user_id AND u.deleted_at IS NULL
+			JOIN conversations c ON c.id=m.conversation_id AND c.type='group'
+			WHERE m.user_id<>$1 AND m.conversation_id IN (SELECT conversation_id FROM conversation_participants WHERE user_id=$1)
+			  AND NOT EXISTS (SELECT 1 FROM conversation_participants o WHERE o.conversation_id=m.conversation_id AND o.role='owner')
+			ORDER BY m.conversation_id, m.role='admin' DESC, m.joined_at, m.user_id) n
+			WHERE p.conversation_id=n.conversation_id AND p.user_id=n.user_id`,
+		`UPDATE users SET email='deleted-'||id||'@deleted.invalid', password_hash='', email_verified_at=NULL, role='user',
+			display_name=NULL, avatar_url=NULL, bio=NULL, timezone=NULL, last_seen_at=NULL,
+			tokens_valid_after=now(), deleted_at=now(), deletion_scheduled_for=NULL WHERE id=$1`,
+		`DELETE FROM conversations c WHERE c.id IN (SELECT conversation_id FROM conversation_participants WHERE user_id=$1)
+			AND NOT EXISTS (SELECT 1 FROM conversation_participants p JOIN users u ON u.id=p.user_id WHERE p.conversation_id=c.id AND u.deleted_at IS NULL)`,
+		// Unlike direct chats, groups simply lose the member.
+		`DELETE FROM conversation_participants WHERE user_id=$1 AND conversation_id IN (SELECT id FROM conversations WHERE type='group')`,
+	}
+	if mode == ModeRemove { stmts = append([]string{`DELETE FROM messages WHERE sender_id=$1`}, stmts...) }
+	for _, q := range stmts {
+		if _, err := tx.Exec(q, userID); err != nil { return err }
+	}
+	return tx.Commit()
+}
+
+// StartDeletionFinalizer finalizes due deletions every interval.
+func StartDeletionFinalizer(s *Service, every time.Duration) {
+	t := time.NewTicker(every)
+	defer t.Stop()
+	for range t.C {
+		var due []string
+		if err := s.st.DB.Select(&due, `SELECT id FROM users WHERE deleted_at IS NULL AND deletion_scheduled_for <= now() LIMIT 100`); err != nil {
+			log.Printf("deletion finalizer: %v", err); continue
+		}
+		for _, id := range due {
+			if err := s.Finalize(id); err != nil && !errors.Is(err, ErrNotScheduled) { log.Printf("finalize deletion of %s: %v", id, err) }
+		}
+	}
+}
@@ -0,0 +1,74 @@
+package users
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"go-chat-backend/internal/auth"
+)
+
+type deleteReq struct {
+	Password string `json:"password"`
+	Code     string `json:"code"` // second factor, for accounts without a password
+	Mode     string `json:"mode"` // anonymize (default) or remove
+}
+
+// HandleDeleteMe schedules deletion of the caller's account (DELETE
+// /api/users/me) and signs them out everywhere.
+func HandleDeleteMe(s *Service, authSvc *auth.Service, rev *auth.Revoker, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	var req deleteReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	if req.Mode == "" { req.Mode = ModeAnonymize }
+	err := authSvc.Reauthenticate(u, req.Password, req.Code)
+	if errors.Is(err, auth.ErrWrongPassword) || errors.Is(err, auth.ErrInvalidCode) || errors.Is(err, auth.ErrReauthRequired) {
+		http.Error(w, err.Error(), http.StatusForbidden); return nil
+	}
+	if err != nil { return err }
+	due, err := s.ScheduleDeletion(u.UserID, req.Mode)
+	if err != nil { return err }
+	if err := rev.RevokeAll(u.UserID); err != nil { return err }
+	w.WriteHeader(http.StatusAccepted)
+	return json.NewEncoder(w).Encode(map[string]any{"status": "scheduled", "deletion_scheduled_for": due, "mode": req.Mode})
+}
+
+// HandleProfile serves GET and PATCH /api/users/me/profile.
+func HandleProfile(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	if r.Method == http.MethodGet {
+		p, err := s.OwnProfile(u.UserID)
+		if err != nil { return err }
+		return json.NewEncoder(w).Encode(p)
+	}
+	var req ProfileUpdate
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil { return err }
+	p, err := s.UpdateProfile(u.UserID, req)
+	var ve *ValidationError
+	if errors.As(err, &ve) { http.Error(w, err.Error(), http.StatusUnprocessableEntity); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(p)
+}
+
+// HandleGetUser serves GET /api/users/{id}.
+func HandleGetUser(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	p, err := s.GetProfile(u.UserID, strings.TrimPrefix(r.URL.Path, "/api/users/"))
+	if errors.Is(err, ErrUserNotFound) { http.Error(w, err.Error(), http.StatusNotFound); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(p)
+}
+
+// HandleSearch serves GET /api/users/search?q=&limit=&offset=.
+func HandleSearch(s *Service, jwt *auth.JWT, w http.ResponseWriter, r *http.Request) error {
+	u := r.Context().Value("user").(*auth.Claims)
+	q := r.URL.Query()
+	limit, _ := strconv.Atoi(q.Get("limit"))
+	offset, _ := strconv.Atoi(q.Get("offset"))
+	page, err := s.Search(u.UserID, q.Get("q"), limit, offset)
+	if errors.Is(err, ErrQueryTooShort) { http.Error(w, err.Error(), http.StatusBadRequest); return nil }
+	if err != nil { return err }
+	return json.NewEncoder(w).Encode(page)
+}
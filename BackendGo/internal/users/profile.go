@@ -0,0 +1,141 @@
+package users
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strings"
+	"time"
+	_ "time/tzdata" // timezone validation must not depend on the host's zoneinfo
+	"unicode"
+	"unicode/utf8"
+
+	"go-chat-backend/internal/privacy"
+	"go-chat-backend/internal/store"
+)
+
+const (
+	maxDisplayName = 64
+	maxBio         = 500
+	maxAvatarURL   = 1024
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+// Profile is what other users see about someone.
+type Profile struct {
+	ID          string  `db:"id" json:"id"`
+	DisplayName string  `db:"display_name" json:"display_name"`
+	AvatarURL   *string `db:"avatar_url" json:"avatar_url"`
+	Bio         *string `db:"bio" json:"bio"`
+	Timezone    *string `db:"timezone" json:"timezone"`
+	Deleted     bool    `db:"deleted" json:"deleted,omitempty"`
+	// Discoverable is only reported to the user themselves.
+	Discoverable *bool `db:"-" json:"discoverable,omitempty"`
+}
+
+// ProfileUpdate is a partial update: nil fields are left alone, empty strings clear.
+type ProfileUpdate struct {
+	DisplayName *string `json:"display_name"`
+	AvatarURL   *string `json:"avatar_url"`
+	Bio         *string `json:"bio"`
+	Timezone    *string `json:"timezone"`
+	// Discoverable controls whether the user shows up in directory search.
+	Discoverable *bool `json:"discoverable"`
+}
+
+// ValidationError names the offending field.
+type ValidationError struct{ Field, Reason string }
+
+func (e *ValidationError) Error() string { return e.Field + ": " + e.Reason }
+
+// Normalize trims the update in place and checks every field that is set.
+func (p *ProfileUpdate) Normalize() error {
+	if p.DisplayName != nil {
+		v := strings.TrimSpace(*p.DisplayName)
+		if utf8.RuneCountInString(v) > maxDisplayName { return &ValidationError{"display_name", "must be at most 64 characters"} }
+		if strings.IndexFunc(v, unicode.IsControl) >= 0 { return &ValidationError{"display_name", "must not contain control characters"} }
+		p.DisplayName = &v
+	}
+	if p.Bio != nil {
+		v := strings.TrimSpace(*p.Bio)
+		if utf8.RuneCountInString(v) > maxBio { return &ValidationError{"bio", "must be at most 500 characters"} }
+		p.Bio = &v
+	}
+	if p.AvatarURL != nil {
+		v := strings.TrimSpace(*p.AvatarURL)
+		if v != "" {
+			u, err := url.Parse(v)
+			if err != nil || u.Scheme != "https" || u.Host == "" || len(v) > maxAvatarURL { return &ValidationError{"avatar_url", "must be an https URL"} }
+		}
+		p.AvatarURL = &v
+	}
+	if p.Timezone != nil {
+		v := strings.TrimSpace(*p.Timezone)
+		if v != "" {
+			// LoadLocation also accepts "Local" and "", which mean nothing to other users.
+			if _, err := time.LoadLocation(v); err != nil || v == "Local" { return &ValidationError{"timezone", "must be an IANA zone such as Europe/Berlin"} }
+		}
+		p.Timezone = &v
+	}
+	return nil
+}
+
+// DisplayName is the name shown for a user: their chosen name, else "User"
+// and the start of their id. It is shown to other users, so it must never
+// be derived from the email. Tombstoned accounts are "Deleted user".
+func DisplayName(name, id string, deleted bool) string {
+	if deleted { return "Deleted user" }
+	if name != "" { return name }
+	if len(id) > 8 { id = id[:8] }
+	return "User " + id
+}
+
+// profileCols selects a Profile from users u; display_name is resolved by
+// scanProfile via DisplayName.
+const profileCols = `u.id, COALESCE(u.display_name,'') AS display_name, u.avatar_url, u.bio, u.timezone, u.deleted_at IS NOT NULL AS deleted`
+
+// photoVisibleCol is true when $1 may see u's avatar.
+var photoVisibleCol = privacy.VisibleSQL(privacy.ProfilePhoto, "$1::uuid", "u.id") + ` AS photo_visible`
+
+// GetProfile returns id's profile as viewerID sees it.
+func (s *Service) GetProfile(viewerID, id string) (*Profile, error) {
+	if !store.IsUUID(id) { return nil, ErrUserNotFound }
+	var row struct {
+		Profile
+		PhotoVisible bool `db:"photo_visible"`
+	}
+	err := s.st.DB.QueryRowx(`SELECT `+profileCols+`, `+photoVisibleCol+` FROM users u WHERE u.id=$2`, viewerID, id).StructScan(&row)
+	if errors.Is(err, sql.ErrNoRows) { return nil, ErrUserNotFound }
+	if err != nil { return nil, err }
+	p := row.Profile
+	p.DisplayName = DisplayName(p.DisplayName, p.ID, p.Deleted)
+	if p.Deleted { p.AvatarURL, p.Bio, p.Timezone = nil, nil, nil }
+	if !row.PhotoVisible { p.AvatarURL = nil }
+	return &p, nil
+}
+
+// UpdateProfile applies a partial update to id's profile.
+func (s *Service) UpdateProfile(id string, p ProfileUpdate) (*Profile, error) {
+	if err := p.Normalize(); err != nil { return nil, err }
+	// A NULL parameter keeps the column; "" clears it.
+	_, err := s.st.DB.Exec(`UPDATE users SET
+		display_name = CASE WHEN $2::text IS NULL THEN display_name ELSE NULLIF($2,'') END,
+		avatar_url   = CASE WHEN $3::text IS NULL THEN avatar_url ELSE NULLIF($3,'') END,
+		bio          = CASE WHEN $4::text IS NULL THEN bio ELSE NULLIF($4,'') END,
+		timezone     = CASE WHEN $5::text IS NULL THEN timezone ELSE NULLIF($5,'') END,
+		discoverable = COALESCE($6, discoverable)
+		WHERE id=$1 AND deleted_at IS NULL`, id, p.DisplayName, p.AvatarURL, p.Bio, p.Timezone, p.Discoverable)
+	if err != nil { return nil, err }
+	return s.OwnProfile(id)
+}
+
+// OwnProfile is GetProfile plus the settings only the owner may see.
+func (s *Service) OwnProfile(id string) (*Profile, error) {
+	p, err := s.GetProfile(id, id)
+	if err != nil { return nil, err }
+	var d bool
+	if err := s.st.DB.QueryRowx(`SELECT discoverable FROM users WHERE id=$1`, id).Scan(&d); err != nil { return nil, err }
+	p.Discoverable = &d
+	return p, nil
+}
@@ -0,0 +1,38 @@
+package users
+
+import (
+	"strings"
+	"testing"
+)
+
+func ptr(s string) *string { return &s }
+
+func TestProfileUpdateNormalize(t *testing.T) {
+	ok := ProfileUpdate{DisplayName: ptr("  Ann Lee "), AvatarURL: ptr("https://cdn.example.com/a.png"), Bio: ptr(""), Timezone: ptr("Europe/Berlin")}
+	if err := ok.Normalize(); err != nil { t.Fatal(err) }
+	if *ok.DisplayName != "Ann Lee" { t.Errorf("display name not trimmed: %q", *ok.DisplayName) }
+
+	bad := map[string]ProfileUpdate{
+		"display_name": {DisplayName: ptr(strings.Repeat("é", 65))},
+		"avatar_url":   {AvatarURL: ptr("javascript:alert(1)")},
+		"bio":          {Bio: ptr(strings.Repeat("x", 501))},
+		"timezone":     {Timezone: ptr("Mars/Olympus")},
+	}
+	for field, u := range bad {
+		err := u.Normalize()
+		ve, isVE := err.(*ValidationError)
+		if !isVE || ve.Field != field { t.Errorf("%s: got %v", field, err) }
+	}
+	if err := (&ProfileUpdate{Timezone: ptr("Local")}).Normalize(); err == nil { t.Error("Local accepted as timezone") }
+	if err := (&ProfileUpdate{AvatarURL: ptr("http://example.com/a.png")}).Normalize(); err == nil { t.Error("plain http avatar accepted") }
+}
+
+func TestDisplayName(t *testing.T) {
+	if got := DisplayName("", "3f2a9c1d-0000-4000-8000-000000000000", false); got != "User 3f2a9c1d" { t.Errorf("fallback = %q", got) }
+	if got := DisplayName("Ann", "ann@example.com", false); got != "Ann" { t.Errorf("got %q", got) }
+	if got := DisplayName("Ann", "x", true); got != "Deleted user" { t.Errorf("tombstone = %q", got) }
+}
+
+func TestLikePrefix(t *testing.T) {
+	if got := likePrefix(`50%_a\b`); got != `50\%\_a\\b%` { t.Errorf("likePrefix = %q", got) }
+}
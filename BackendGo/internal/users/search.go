@@ -0,0 +1,69 @@
+package users
+
+import (
+	"errors"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	minQueryLen     = 3
+	maxSearchLimit  = 25
+	maxSearchOffset = 100 // deep paging only helps scraping the directory
+)
+
+var ErrQueryTooShort = errors.New("search query must be at least 3 characters")
+
+// SearchPage is one page of results with the limit and offset actually used.
+type SearchPage struct {
+	Results []SearchResult `json:"results"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+}
+
+// SearchResult is a profile plus whether the viewer already has it as a contact.
+type SearchResult struct {
+	Profile
+	IsContact bool `db:"is_contact" json:"is_contact"`
+}
+
+// Search finds verified users by display name prefix, then by trigram
+// similarity, among those who opted in to discoverability or are already
+// the viewer's contacts. An email only matches exactly, so it cannot be
+// guessed letter by letter; emails are never part of the results.
+func (s *Service) Search(viewerID, q string, limit, offset int) (*SearchPage, error) {
+	q = strings.ToLower(strings.TrimSpace(q))
+	if utf8.RuneCountInString(q) < minQueryLen { return nil, ErrQueryTooShort }
+	if limit <= 0 || limit > maxSearchLimit { limit = maxSearchLimit }
+	if offset < 0 { offset = 0 }
+	page := &SearchPage{Results: []SearchResult{}, Limit: limit, Offset: offset}
+	if offset > maxSearchOffset { return page, nil }
+
+	rows, err := s.st.DB.Queryx(`SELECT `+profileCols+`,
+			EXISTS(SELECT 1 FROM contacts c WHERE c.owner_id=$1 AND c.contact_id=u.id) AS is_contact, `+photoVisibleCol+`
+		FROM users u
+		WHERE u.id <> $1 AND u.deleted_at IS NULL AND u.email_verified_at IS NOT NULL
+		  AND NOT EXISTS(SELECT 1 FROM user_blocks b WHERE b.blocker_id=u.id AND b.blocked_id=$1)
+		  AND (u.email = $2 OR ((u.discoverable OR EXISTS(SELECT 1 FROM contacts c WHERE c.owner_id=$1 AND c.contact_id=u.id))
+		    AND (lower(u.display_name) LIKE $3 OR lower(u.display_name) % $2)))
+		ORDER BY u.email = $2 DESC, lower(u.display_name) LIKE $3 DESC, similarity(lower(COALESCE(u.display_name,'')), $2) DESC, u.id
+		LIMIT $4 OFFSET $5`, viewerID, q, likePrefix(q), limit, offset)
+	if err != nil { return nil, err }
+	defer rows.Close()
+	for rows.Next() {
+		var row struct {
+			SearchResult
+			PhotoVisible bool `db:"photo_visible"`
+		}
+		if err := rows.StructScan(&row); err != nil { return nil, err }
+		row.DisplayName = DisplayName(row.DisplayName, row.ID, false)
+		if !row.PhotoVisible { row.AvatarURL = nil }
+		page.Results = append(page.Results, row.SearchResult)
+	}
+	return page, rows.Err()
+}
+
+// likePrefix escapes LIKE wildcards in q and appends %.
+func likePrefix(q string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(q) + "%"
+}
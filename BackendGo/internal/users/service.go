@@ -0,0 +1,18 @@
+package users
+
+import (
+	"time"
+
+	"go-chat-backend/internal/mail"
+	"go-chat-backend/internal/store"
+)
+
+type Service struct {
+	st     *store.Store
+	mailer mail.Sender
+	grace  time.Duration // between a deletion request and its finalization
+}
+
+func NewService(st *store.Store, mailer mail.Sender, grace time.Duration) *Service {
+	return &Service{st: st, mailer: mailer, grace: grace}
+}
@@ -1,20 +1,35 @@
 package ws
 
 import (
+	"encoding/json"
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
+	"go-chat-backend/internal/auth"
 )
 
 type Client struct {
 	conn *websocket.Conn
 	hub  *Hub
 	convID string
-	send chan []byte
+	userID string
+	jti    string
+	sessionID string
+	send chan []byte // never closed: senders may still hold the client after Close
+	done chan struct{} // closed by Close; stops writePump
+	closeOnce sync.Once
+	away bool // reported idle by the client; guarded by hub.mu
 }
 
-func newClient(h *Hub, convID string, conn *websocket.Conn) *Client {
-	return &Client{conn: conn, hub: h, convID: convID, send: make(chan []byte, 256)}
+// inbound is what clients may send; everything else is ignored.
+type inbound struct {
+	Type   string `json:"type"`
+	Status string `json:"status"`
+}
+
+func newClient(h *Hub, convID string, claims *auth.Claims, conn *websocket.Conn) *Client {
+	return &Client{conn: conn, hub: h, convID: convID, userID: claims.UserID, jti: claims.ID, sessionID: claims.SessionID, send: make(chan []byte, 256), done: make(chan struct{})}
 }
 
 func (c *Client) readPump() {
@@ -23,7 +38,12 @@ func (c *Client) readPump() {
 	c.conn.SetReadDeadline(time.Now().Add(pongWait))
 	c.conn.SetPongHandler(func(string) error { c.conn.SetReadDeadline(time.Now().Add(pongWait)); return nil })
 	for {
-		if _, _, err := c.conn.ReadMessage(); err != nil { return }
+		_, data, err := c.conn.ReadMessage()
+		if err != nil { return }
+		var in inbound
+		if json.Unmarshal(data, &in) != nil { continue }
+		// {"type":"presence","status":"away"} when the tab goes idle, "online" when it is back.
+		if in.Type == "presence" && (in.Status == StatusAway || in.Status == StatusOnline) { c.hub.setAway(c, in.Status == StatusAway) }
 	}
 }
 
@@ -32,9 +52,12 @@ func (c *Client) writePump() {
 	defer func(){ ticker.Stop(); c.conn.Close() }()
 	for {
 		select {
-		case msg, ok := <-c.send:
+		case <-c.done:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			c.conn.WriteMessage(websocket.CloseMessage, []byte{})
+			return
+		case msg := <-c.send:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
-			if !ok { c.conn.WriteMessage(websocket.CloseMessage, []byte{}); return }
 			if err := c.conn.WriteMessage(websocket.TextMessage, msg); err != nil { return }
 		case <-ticker.C:
 			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
@@ -44,7 +67,15 @@ func (c *Client) writePump() {
 }
 
 func (c *Client) Close() {
-	c.hub.Leave(c.convID, c)
-	close(c.send)
-	_ = c.conn.Close()
+	c.closeOnce.Do(func() {
+		c.hub.Leave(c.convID, c)
+		close(c.done)
+		_ = c.conn.Close()
+	})
+}
+
+// kick tells the peer why it is being disconnected before closing.
+func (c *Client) kick(code int, reason string) {
+	_ = c.conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, reason), time.Now().Add(writeWait))
+	c.Close()
 }
\ No newline at end of file
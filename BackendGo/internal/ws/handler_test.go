@@ -0,0 +1,27 @@
+package ws
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCheckOrigin(t *testing.T) {
+	check := checkOrigin("https://app.example.com, https://admin.example.com")
+	cases := []struct {
+		origin string
+		want   bool
+	}{
+		{"", true},
+		{"http://chat.local:8080", true}, // same host as the request
+		{"https://app.example.com", true},
+		{"https://admin.example.com", true},
+		{"https://evil.example.com", false},
+		{"https://app.example.com.evil.net", false},
+		{"https://example.com", false},
+	}
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", "http://chat.local:8080/ws", nil)
+		if c.origin != "" { r.Header.Set("Origin", c.origin) }
+		if got := check(r); got != c.want { t.Errorf("origin %q: got %v want %v", c.origin, got, c.want) }
+	}
+}
@@ -5,40 +5,206 @@ import (
 	"sync"
 	"time"
 
+	"go-chat-backend/internal/auth"
 	"go-chat-backend/internal/conversations"
 )
 
+// Presence states derived from a user's live connections.
+const (
+	StatusOnline  = "online"
+	StatusAway    = "away"
+	StatusOffline = "offline"
+)
+
+// offlineGrace delays "offline" after the last connection drops so a page
+// reload does not flap presence for everyone watching.
+const offlineGrace = 5 * time.Second
+
 type Hub struct {
 	Conversations *conversations.Service
 	rooms map[string]map[*Client]bool
+	users map[string]map[*Client]bool // every live client per user, across rooms
+	status map[string]string          // last announced presence per connected user
+	offline map[string]*time.Timer    // pending offline announcements
+	listeners []func(userID, status string)
 	mu    sync.RWMutex
+
+	// Presence changes are queued in order under mu and handed to listeners
+	// by Run, so listeners (which may hit the database) never run on a
+	// client's goroutine and always see transitions in order.
+	qmu     sync.Mutex
+	queue   []presenceEvent
+	wake    chan struct{}
 }
 
+type presenceEvent struct{ userID, status string }
+
 func NewHub(msgSvc any, convSvc *conversations.Service) *Hub {
-	return &Hub{Conversations: convSvc, rooms: make(map[string]map[*Client]bool)}
+	return &Hub{Conversations: convSvc, rooms: make(map[string]map[*Client]bool), users: make(map[string]map[*Client]bool),
+		status: make(map[string]string), offline: make(map[string]*time.Timer), wake: make(chan struct{}, 1)}
 }
 
-func (h *Hub) Run() { /* placeholder for future housekeeping */ }
+// Run delivers queued presence changes to the listeners; start it once.
+func (h *Hub) Run() {
+	for range h.wake {
+		h.qmu.Lock(); evs := h.queue; h.queue = nil; h.qmu.Unlock()
+		h.mu.RLock(); ls := h.listeners; h.mu.RUnlock()
+		for _, ev := range evs {
+			for _, fn := range ls { fn(ev.userID, ev.status) }
+		}
+	}
+}
 
-func (h *Hub) Join(convID string, c *Client) {
+// OnPresence registers fn to be called whenever a user's presence changes.
+// Register listeners before serving connections.
+func (h *Hub) OnPresence(fn func(userID, status string)) {
 	h.mu.Lock(); defer h.mu.Unlock()
-	if h.rooms[convID] == nil { h.rooms[convID] = make(map[*Client]bool) }
-	h.rooms[convID][c] = true
+	h.listeners = append(h.listeners, fn)
+}
+
+// Join registers c; clients without a conversation only receive user events.
+func (h *Hub) Join(convID string, c *Client) {
+	h.mu.Lock()
+	if convID != "" {
+		if h.rooms[convID] == nil { h.rooms[convID] = make(map[*Client]bool) }
+		h.rooms[convID][c] = true
+	}
+	if h.users[c.userID] == nil { h.users[c.userID] = make(map[*Client]bool) }
+	h.users[c.userID][c] = true
+	if t := h.offline[c.userID]; t != nil { t.Stop(); delete(h.offline, c.userID) }
+	h.refreshLocked(c.userID)
+	h.mu.Unlock()
 }
 
 func (h *Hub) Leave(convID string, c *Client) {
-	h.mu.Lock(); defer h.mu.Unlock()
+	h.mu.Lock()
 	if m := h.rooms[convID]; m != nil { delete(m, c); if len(m)==0 { delete(h.rooms, convID) } }
+	if m := h.users[c.userID]; m != nil {
+		delete(m, c)
+		if len(m) == 0 {
+			delete(h.users, c.userID)
+			if h.offline[c.userID] == nil {
+				uid := c.userID
+				h.offline[uid] = time.AfterFunc(offlineGrace, func() { h.goOffline(uid) })
+			}
+			h.mu.Unlock()
+			return
+		}
+	}
+	h.refreshLocked(c.userID)
+	h.mu.Unlock()
+}
+
+func (h *Hub) goOffline(userID string) {
+	h.mu.Lock()
+	delete(h.offline, userID)
+	if len(h.users[userID]) > 0 { h.mu.Unlock(); return }
+	h.refreshLocked(userID)
+	h.mu.Unlock()
+}
+
+// setAway marks one connection idle or active, as reported by the client.
+func (h *Hub) setAway(c *Client, away bool) {
+	h.mu.Lock()
+	c.away = away
+	h.refreshLocked(c.userID)
+	h.mu.Unlock()
+}
+
+// refreshLocked recomputes userID's presence and queues it if it changed.
+func (h *Hub) refreshLocked(userID string) {
+	now := h.presenceLocked(userID)
+	if h.status[userID] == now || (now == StatusOffline && h.status[userID] == "") { return }
+	if now == StatusOffline { delete(h.status, userID) } else { h.status[userID] = now }
+	h.qmu.Lock(); h.queue = append(h.queue, presenceEvent{userID, now}); h.qmu.Unlock()
+	select { case h.wake <- struct{}{}: default: }
+}
+
+// presenceLocked: online if any connection is active, away if all are idle.
+func (h *Hub) presenceLocked(userID string) string {
+	conns := h.users[userID]
+	if len(conns) == 0 {
+		// Still inside the grace period: keep showing the last state.
+		if h.offline[userID] != nil && h.status[userID] != "" { return h.status[userID] }
+		return StatusOffline
+	}
+	for c := range conns { if !c.away { return StatusOnline } }
+	return StatusAway
+}
+
+
+// Presence returns userID's current presence.
+func (h *Hub) Presence(userID string) string {
+	h.mu.RLock(); defer h.mu.RUnlock()
+	if s := h.status[userID]; s != "" { return s }
+	return StatusOffline
 }
 
 func (h *Hub) Broadcast(convID string, payload any) {
+	h.mu.RLock(); conns := clients(h.rooms[convID]); h.mu.RUnlock()
+	h.deliver(conns, payload)
+}
+
+// SendToUser delivers payload to every connection of userID.
+func (h *Hub) SendToUser(userID string, payload any) {
+	h.mu.RLock(); conns := clients(h.users[userID]); h.mu.RUnlock()
+	h.deliver(conns, payload)
+}
+
+// deliver queues payload for conns, which may have closed since they were
+// copied; a full queue means the client is stuck and gets dropped.
+func (h *Hub) deliver(conns []*Client, payload any) {
+	if len(conns) == 0 { return }
 	b, _ := json.Marshal(payload)
-	h.mu.RLock(); conns := h.rooms[convID]; h.mu.RUnlock()
-	for c := range conns { select { case c.send <- b: default: go c.Close() } }
+	for _, c := range conns {
+		select {
+		case <-c.done:
+		case c.send <- b:
+		default: go c.Close()
+		}
+	}
+}
+
+// clients copies a client set so it can be used after the lock is released.
+func clients(m map[*Client]bool) []*Client {
+	out := make([]*Client, 0, len(m))
+	for c := range m { out = append(out, c) }
+	return out
+}
+
+// RemoveFromConversation closes userID's connections to convID after they
+// left or were removed from it; their other connections stay open.
+func (h *Hub) RemoveFromConversation(convID, userID string) {
+	var victims []*Client
+	h.mu.RLock()
+	for c := range h.rooms[convID] {
+		if c.userID == userID { victims = append(victims, c) }
+	}
+	h.mu.RUnlock()
+	for _, c := range victims { c.kick(closeRemoved, "removed from conversation") }
+}
+
+// DisconnectRevoked force-closes every live client whose token was revoked.
+func (h *Hub) DisconnectRevoked(ev auth.Revocation) {
+	var victims []*Client
+	h.mu.RLock()
+	for _, conns := range h.users {
+		for c := range conns {
+			if (ev.JTI != "" && c.jti == ev.JTI) || (ev.SessionID != "" && c.sessionID == ev.SessionID) || (ev.All && c.userID == ev.UserID) {
+				victims = append(victims, c)
+			}
+		}
+	}
+	h.mu.RUnlock()
+	for _, c := range victims { c.kick(closeTokenRevoked, "token revoked") }
 }
 
 const (
+	// closeTokenRevoked is an application close code (4000-4999 range).
+	closeTokenRevoked = 4001
+	closeRemoved      = 4003
+
 	writeWait = 10 * time.Second
 	pongWait  = 60 * time.Second
 	pingPeriod = (pongWait * 9) / 10
-)
\ No newline at end of file
+)
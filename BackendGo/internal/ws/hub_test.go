@@ -0,0 +1,53 @@
+package ws
+
+import (
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestHubPresence(t *testing.T) {
+	h := NewHub(nil, nil)
+	var (
+		mu  sync.Mutex
+		got []string
+	)
+	h.OnPresence(func(userID, status string) { mu.Lock(); got = append(got, userID+":"+status); mu.Unlock() })
+	go h.Run()
+	a := &Client{hub: h, userID: "u1", convID: "c1", send: make(chan []byte, 4)}
+	b := &Client{hub: h, userID: "u1", send: make(chan []byte, 4)}
+
+	h.Join("c1", a)
+	h.Join("", b)
+	h.setAway(a, true)
+	if s := h.Presence("u1"); s != StatusOnline { t.Fatalf("one active connection left, got %s", s) }
+	h.setAway(b, true)
+	h.setAway(b, false)
+
+	h.SendToUser("u1", map[string]string{"type": "ping"})
+	if len(a.send) != 1 || len(b.send) != 1 { t.Fatalf("SendToUser reached %d/%d clients", len(a.send), len(b.send)) }
+
+	h.Leave("c1", a)
+	h.Leave("", b)
+	if s := h.Presence("u1"); s != StatusOnline { t.Fatalf("offline announced inside grace period: %s", s) }
+	h.goOffline("u1")
+	if s := h.Presence("u1"); s != StatusOffline { t.Fatalf("after grace got %s", s) }
+
+	want := []string{"u1:online", "u1:away", "u1:online", "u1:offline"}
+	for deadline := time.Now().Add(time.Second); time.Now().Before(deadline); time.Sleep(5 * time.Millisecond) {
+		mu.Lock(); n := len(got); mu.Unlock()
+		if n >= len(want) { break }
+	}
+	mu.Lock(); defer mu.Unlock()
+	if !reflect.DeepEqual(got, want) { t.Errorf("events = %v, want %v", got, want) }
+}
+
+// A client closed after deliver copied it must be skipped, not written to.
+func TestDeliverSkipsClosedClient(t *testing.T) {
+	h := NewHub(nil, nil)
+	c := &Client{hub: h, userID: "u1", send: make(chan []byte), done: make(chan struct{})}
+	close(c.done)
+	h.deliver([]*Client{c}, map[string]string{"type": "ping"})
+	if len(c.send) != 0 { t.Fatal("payload queued for a closed client") }
+}